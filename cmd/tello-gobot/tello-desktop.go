@@ -39,6 +39,8 @@ import (
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/platforms/dji/tello"
 	"gobot.io/x/gobot/platforms/joystick"
+
+	"github.com/SMerrony/tello-desktop/assets"
 )
 
 const telloUDPport = "8890"
@@ -88,7 +90,6 @@ const (
 	winTitle                                = "Tello Desktop"
 	winWidth, winHeight                     = 800, 600
 	winUpdatePeriod                         = 333 * time.Millisecond
-	fontPath                                = "../../assets/Inconsolata-Bold.ttf"
 	bigFontSize, medFontSize, smallFontSize = 32, 24, 12
 )
 
@@ -97,6 +98,7 @@ var (
 	controlFlag = flag.String("control", "keyboard", "Gobot controller <keyboard|dualshock4|tflightHotasX")
 	joyHelpFlag = flag.Bool("joyhelp", false, "Print help for joystick control mapping and exit")
 	keyHelpFlag = flag.Bool("keyhelp", false, "Print help for keyboard control mapping and exit")
+	fontFlag    = flag.String("font", "", "TrueType font file to use instead of the built-in font")
 )
 
 var (
@@ -452,12 +454,12 @@ func setupWindow() {
 	if err = ttf.Init(); err != nil {
 		panic(err)
 	}
-	bigFont, err = ttf.OpenFont(fontPath, bigFontSize)
+	bigFont, err = openFont(bigFontSize)
 	if err != nil {
-		log.Fatalf("Failed to open font %s due to %v", fontPath, err)
+		log.Fatalf("Failed to open font due to %v", err)
 	}
-	medFont, _ = ttf.OpenFont(fontPath, medFontSize)
-	smallFont, _ = ttf.OpenFont(fontPath, smallFontSize)
+	medFont, _ = openFont(medFontSize)
+	smallFont, _ = openFont(smallFontSize)
 	window, err = sdl.CreateWindow(winTitle, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, winWidth, winHeight, sdl.WINDOW_SHOWN)
 	if err != nil {
 		panic(err)
@@ -473,6 +475,19 @@ func setupWindow() {
 	go sdlEventListener()
 }
 
+// openFont loads the font given by the -font flag, or the built-in one if that is not set
+func openFont(size int) (*ttf.Font, error) {
+	if *fontFlag != "" {
+		return ttf.OpenFont(*fontFlag, size)
+	}
+	rw, err := sdl.RWFromMem(assets.Font)
+	if err != nil {
+		return nil, err
+	}
+	// the RWops is freed when the font is closed
+	return ttf.OpenFontRW(rw, 1, size)
+}
+
 func updateWindow() {
 	surface.FillRect(nil, 0)
 
@@ -0,0 +1,189 @@
+// audio.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"time"
+)
+
+// audio output is done via external programs in the same way as the video
+const (
+	audioPlayerCmd  = "aplay"
+	audioSpeechCmd  = "espeak"
+	audioSampleRate = 22050
+	audioQueueLen   = 8
+)
+
+// battery percentages at which an escalating warning is sounded
+var batteryWarnLevels = []int8{50, 30, 20, 15, 10, 5}
+
+// tone is a single beep
+type tone struct {
+	freq float64
+	dur  time.Duration
+}
+
+// audioCue is a sequence of beeps, optionally followed by a spoken message
+type audioCue struct {
+	tones  []tone
+	speech string
+}
+
+var (
+	takeOffCue = audioCue{tones: []tone{{440, 150 * time.Millisecond}, {880, 250 * time.Millisecond}}, speech: "Take off"}
+	landingCue = audioCue{tones: []tone{{880, 150 * time.Millisecond}, {440, 250 * time.Millisecond}}, speech: "Landed"}
+)
+
+var (
+	audioChan     chan audioCue
+	speechOK      bool
+	lastBattWarn  = -1
+	lastCalloutAt time.Time
+)
+
+func startAudio() {
+	if _, err := exec.LookPath(audioPlayerCmd); err != nil {
+		log.Printf("Audio disabled - cannot find %s\n", audioPlayerCmd)
+		return
+	}
+	if _, err := exec.LookPath(audioSpeechCmd); err == nil {
+		speechOK = true
+	} else {
+		log.Printf("Spoken callouts disabled - cannot find %s\n", audioSpeechCmd)
+	}
+	audioChan = make(chan audioCue, audioQueueLen)
+	go audioPlayer()
+}
+
+// queueCue never blocks as it is called from the flight data goroutine
+func queueCue(c audioCue) {
+	if audioChan == nil {
+		return
+	}
+	select {
+	case audioChan <- c:
+	default:
+		log.Println("Audio queue full, cue dropped")
+	}
+}
+
+func audioPlayer() {
+	defer blackBoxOnPanic()
+	for c := range audioChan {
+		if len(c.tones) > 0 {
+			cmd := exec.Command(audioPlayerCmd, "-q", "-")
+			cmd.Stdin = bytes.NewReader(makeWav(c.tones))
+			if err := cmd.Run(); err != nil {
+				log.Printf("Error playing audio cue %v\n", err)
+			}
+		}
+		if c.speech != "" && speechOK {
+			if err := exec.Command(audioSpeechCmd, c.speech).Run(); err != nil {
+				log.Printf("Error speaking callout %v\n", err)
+			}
+		}
+	}
+}
+
+// checkAudioCues must be called with flightDataMu held
+func checkAudioCues(ev flightEvent) {
+	if audioChan == nil {
+		return
+	}
+	switch ev {
+	case takeOffEvent:
+		queueCue(takeOffCue)
+		lastCalloutAt = time.Now()
+	case landingEvent:
+		queueCue(landingCue)
+	}
+
+	// each lower battery level gets more, higher-pitched beeps
+	lvl := -1
+	if !haveFlightData(&flightData) {
+		return
+	}
+	for i, pct := range batteryWarnLevels {
+		if flightData.BatteryPercentage <= pct {
+			lvl = i
+		}
+	}
+	if lvl > lastBattWarn {
+		lastBattWarn = lvl
+		c := audioCue{speech: fmt.Sprintf("Battery %d percent", flightData.BatteryPercentage)}
+		for i := 0; i <= lvl; i++ {
+			c.tones = append(c.tones, tone{600 + 150*float64(lvl), 120 * time.Millisecond})
+		}
+		queueCue(c)
+	}
+
+	if *calloutFlag > 0 && flightData.Flying && time.Since(lastCalloutAt) >= time.Duration(*calloutFlag)*time.Second {
+		lastCalloutAt = time.Now()
+		queueCue(audioCue{speech: fmt.Sprintf("Height %.1f metres, battery %d percent",
+			float32(flightData.Height)/10, flightData.BatteryPercentage)})
+	}
+}
+
+// wavFmt is the "fmt " chunk of a WAV file
+type wavFmt struct {
+	ChunkSize                 uint32
+	Format, Channels          uint16
+	SampleRate, ByteRate      uint32
+	BlockAlign, BitsPerSample uint16
+}
+
+// makeWav builds a 16-bit mono WAV file containing the given tones separated by short gaps
+func makeWav(tones []tone) []byte {
+	var samples []int16
+	gap := make([]int16, audioSampleRate/20)
+	for _, t := range tones {
+		n := int(t.dur.Seconds() * audioSampleRate)
+		for i := 0; i < n; i++ {
+			samples = append(samples, int16(math.Sin(2*math.Pi*t.freq*float64(i)/audioSampleRate)*math.MaxInt16/2))
+		}
+		samples = append(samples, gap...)
+	}
+	dataLen := uint32(len(samples) * 2)
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+dataLen)
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, wavFmt{
+		ChunkSize:     16,
+		Format:        1, // PCM
+		Channels:      1,
+		SampleRate:    audioSampleRate,
+		ByteRate:      audioSampleRate * 2,
+		BlockAlign:    2,
+		BitsPerSample: 16,
+	})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataLen)
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
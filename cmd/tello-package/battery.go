@@ -0,0 +1,305 @@
+// battery.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SMerrony/tello"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The Tello cannot tell us which battery is fitted, so the pilot labels each pack and gives the
+// label with -battery (or when asked at startup).  Its history is kept in the logbook: one charge
+// per time the pack was recharged, with the discharge curve against flight time, so that a pack
+// which is draining faster than it used to can be spotted.
+
+const (
+	batteryRechargedPct  = 5                // starting this much above the last level means it was recharged
+	batteryCurvePeriod   = 10 * time.Second // of flight time between points on the discharge curve
+	batteryMinRateTime   = time.Minute      // flight time needed for a meaningful discharge rate
+	batteryLiveCheckTime = 3 * time.Minute  // flight time before the current charge is compared with history
+	batteryRecentCharges = 3                // charges compared with the older ones for degradation
+	batteryDegradeFactor = 1.25             // draining this much faster than usual is a warning
+	batteryMaxSampleGap  = time.Second      // longer gaps in the flight data are not counted as flight time
+)
+
+var batteryBucket = []byte("batteries")
+
+type curvePoint struct {
+	Airtime time.Duration
+	Pct     int8
+}
+
+// batteryCharge is the use of a pack between one recharge and the next
+type batteryCharge struct {
+	Start    time.Time
+	StartPct int8
+	EndPct   int8
+	Airtime  time.Duration
+	Curve    []curvePoint
+}
+
+// drainRate is the percentage used per minute of flight
+func (bc *batteryCharge) drainRate() (rate float64, ok bool) {
+	if bc.Airtime < batteryMinRateTime {
+		return 0, false
+	}
+	return float64(bc.StartPct-bc.EndPct) / bc.Airtime.Minutes(), true
+}
+
+type batteryRecord struct {
+	Label     string
+	FirstUsed time.Time
+	Charges   []batteryCharge
+}
+
+// cycles counts equivalent full charge cycles
+func (br *batteryRecord) cycles() float64 {
+	var used int
+	for _, c := range br.Charges {
+		used += int(c.StartPct - c.EndPct)
+	}
+	return float64(used) / 100
+}
+
+// meanRate averages the drain rates of the given charges which have one
+func meanRate(charges []batteryCharge) (mean float64, n int) {
+	for i := range charges {
+		if r, ok := charges[i].drainRate(); ok {
+			mean += r
+			n++
+		}
+	}
+	if n > 0 {
+		mean /= float64(n)
+	}
+	return mean, n
+}
+
+// health compares the recent charges with the pack's earlier history
+func (br *batteryRecord) health() (msg string, degraded bool) {
+	if len(br.Charges) <= batteryRecentCharges {
+		return "OK (not enough history)", false
+	}
+	split := len(br.Charges) - batteryRecentCharges
+	usual, n := meanRate(br.Charges[:split])
+	recent, m := meanRate(br.Charges[split:])
+	if n == 0 || m == 0 {
+		return "OK (not enough history)", false
+	}
+	if recent > usual*batteryDegradeFactor {
+		return fmt.Sprintf("DEGRADED %.1f%%/min, was %.1f%%/min", recent, usual), true
+	}
+	return fmt.Sprintf("OK %.1f%%/min", recent), false
+}
+
+// batteryTracker follows the pack in use during this session
+type batteryTracker struct {
+	mu         sync.Mutex
+	rec        batteryRecord
+	charge     *batteryCharge // the current charge, set by the first flight data
+	usualRate  float64        // from the previous charges, 0 if unknown
+	lastSample time.Time
+	nextPoint  time.Duration
+	warned     bool
+}
+
+var battery *batteryTracker
+
+// askBatteryLabel asks the pilot which pack is fitted, if there is anyone to ask
+func askBatteryLabel() string {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return ""
+	}
+	fmt.Print("Battery pack label (blank to skip): ")
+	label, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(label)
+}
+
+// startBatteryTracking loads the pack's history from the logbook and warns if it has degraded
+func startBatteryTracking(path, label string) {
+	rec, err := readBattery(path, label)
+	if err != nil {
+		// tracking from an empty record would overwrite the pack's history when we exit
+		log.Printf("Unable to read history of battery %s, not tracking it - %v\n", label, err)
+		return
+	}
+	rec.Label = label
+	if rec.FirstUsed.IsZero() {
+		rec.FirstUsed = time.Now()
+	}
+	battery = &batteryTracker{rec: rec}
+	battery.usualRate, _ = meanRate(rec.Charges)
+	msg, degraded := rec.health()
+	log.Printf("Battery %s: %d charges, %.1f cycles, %s\n", label, len(rec.Charges), rec.cycles(), msg)
+	if degraded {
+		addWarning(fmt.Sprintf("Battery %s %s", label, msg))
+		setFlightMsg("Battery " + label + " degraded")
+	}
+}
+
+// trackBattery is called with every flight data update, it returns a warning if
+// the current charge is draining faster than usual for the pack
+func trackBattery(fd tello.FlightData) (warning string) {
+	if battery == nil || !haveFlightData(&fd) {
+		return ""
+	}
+	bt := battery
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	now := time.Now()
+	if bt.charge == nil {
+		n := len(bt.rec.Charges)
+		if n == 0 || fd.BatteryPercentage > bt.rec.Charges[n-1].EndPct+batteryRechargedPct {
+			bt.rec.Charges = append(bt.rec.Charges, batteryCharge{Start: now, StartPct: fd.BatteryPercentage})
+			n++
+		}
+		bt.charge = &bt.rec.Charges[n-1]
+		bt.nextPoint = bt.charge.Airtime
+		bt.lastSample = now
+	}
+	bc := bt.charge
+	bc.EndPct = fd.BatteryPercentage
+	if fd.Flying {
+		if dt := now.Sub(bt.lastSample); dt < batteryMaxSampleGap {
+			bc.Airtime += dt
+		}
+		if bc.Airtime >= bt.nextPoint {
+			bc.Curve = append(bc.Curve, curvePoint{Airtime: bc.Airtime, Pct: fd.BatteryPercentage})
+			bt.nextPoint = bc.Airtime + batteryCurvePeriod
+		}
+	}
+	bt.lastSample = now
+	if !bt.warned && bt.usualRate > 0 && bc.Airtime >= batteryLiveCheckTime {
+		if rate, ok := bc.drainRate(); ok && rate > bt.usualRate*batteryDegradeFactor {
+			bt.warned = true
+			return fmt.Sprintf("Battery %s Draining Fast", bt.rec.Label)
+		}
+	}
+	return ""
+}
+
+func batteryLabel() string {
+	if battery == nil {
+		return ""
+	}
+	return battery.rec.Label
+}
+
+func readBattery(path, label string) (rec batteryRecord, err error) {
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		return rec, nil
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: logbookTimeout, ReadOnly: true})
+	if err != nil {
+		return rec, err
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(batteryBucket)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(label)); v != nil {
+			return json.Unmarshal(v, &rec)
+		}
+		return nil
+	})
+	return rec, err
+}
+
+// saveBattery writes the pack's updated history to the logbook
+func saveBattery(path string) {
+	if battery == nil {
+		return
+	}
+	battery.mu.Lock()
+	val, err := json.Marshal(&battery.rec)
+	label := battery.rec.Label
+	battery.mu.Unlock()
+	if err != nil {
+		log.Printf("Error encoding battery history - %v\n", err)
+		return
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: logbookTimeout})
+	if err != nil {
+		log.Printf("Error opening logbook %s - %v\n", path, err)
+		return
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(batteryBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(label), val)
+	})
+	if err != nil {
+		log.Printf("Error writing battery history to %s - %v\n", path, err)
+	}
+}
+
+// listBatteries prints the health of every pack in the logbook
+func listBatteries(path string) error {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: logbookTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Battery\tFirst Used\tCharges\tCycles\tFlight Time/Charge\tHealth")
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(batteryBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var rec batteryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("bad battery %s - %v", k, err)
+			}
+			var airtime time.Duration
+			for _, c := range rec.Charges {
+				airtime += c.Airtime
+			}
+			perCharge := time.Duration(0)
+			if len(rec.Charges) > 0 {
+				perCharge = airtime / time.Duration(len(rec.Charges))
+			}
+			health, _ := rec.health()
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%s\t%s\n", rec.Label, rec.FirstUsed.Local().Format(logbookDateFmt),
+				len(rec.Charges), rec.cycles(), perCharge.Round(time.Second), health)
+			return nil
+		})
+	})
+	tw.Flush()
+	return err
+}
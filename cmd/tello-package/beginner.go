@@ -0,0 +1,196 @@
+// beginner.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// Beginner mode restricts the flight envelope for newcomers: all stick movements are scaled
+// down, flips and sports mode are refused, the drone will not climb above a low ceiling (and
+// is brought back down if it drifts above it), and it lands by itself after a set flight time.
+
+const (
+	beginnerCeilingMargin = 3 // decimetres above the ceiling before the drone is brought down
+	beginnerDescendPct    = 30
+	beginnerLandWarning   = 15 * time.Second
+)
+
+type beginnerProfile struct {
+	speedPct   int           // of full stick movement
+	ceilingDm  int16         // height ceiling
+	maxFlight  time.Duration // 0 for no limit
+	takeOff    time.Time     // of the current flight
+	descending bool          // brought down from above the ceiling by beginner mode
+	warned     bool
+	landing    bool
+}
+
+// pilotVertical is set when the pilot moves the drone up or down while beginner mode is
+// bringing it down, the pilot's movement is then left alone when the descent ends
+var (
+	beginnerMu    sync.Mutex
+	pilotVertical bool
+)
+
+// beginner is nil unless beginner mode is on, it is only changed in the flight data loop
+// and so is protected by flightDataMu
+var beginner *beginnerProfile
+
+func startBeginnerMode(speedPct int, ceilingM float64, maxFlight time.Duration) {
+	beginner = &beginnerProfile{speedPct: speedPct, ceilingDm: int16(ceilingM * 10), maxFlight: maxFlight}
+	log.Printf("Beginner mode - speed %d%%, ceiling %.1fm, flight time limit %s\n", speedPct, ceilingM, maxFlight)
+}
+
+func beginnerMode() bool {
+	return beginner != nil
+}
+
+// capPct scales a stick percentage for beginners
+func capPct(pct int) int {
+	if beginner == nil {
+		return pct
+	}
+	return pct * beginner.speedPct / 100
+}
+
+// capClimb is capPct for upward movement, which is not allowed at the ceiling
+func capClimb(pct int) int {
+	if beginner == nil {
+		return pct
+	}
+	flightDataMu.RLock()
+	atCeiling := flightData.Height >= beginner.ceilingDm
+	flightDataMu.RUnlock()
+	if atCeiling {
+		return 0
+	}
+	return capPct(pct)
+}
+
+// capSticks limits stick movements for beginners
+func capSticks(sm tello.StickMessage) tello.StickMessage {
+	if beginner == nil {
+		return sm
+	}
+	scale := func(v int16) int16 { return int16(int(v) * beginner.speedPct / 100) }
+	sm.Rx, sm.Ry, sm.Lx = scale(sm.Rx), scale(sm.Ry), scale(sm.Lx)
+	if sm.Ly != 0 {
+		beginnerVertical()
+	}
+	if sm.Ly > 0 {
+		sm.Ly = int16(capClimb(int(sm.Ly)*100/stickFullScale) * stickFullScale / 100)
+	} else {
+		sm.Ly = scale(sm.Ly)
+	}
+	return sm
+}
+
+// beginnerVertical notes that the pilot has moved the drone up or down
+func beginnerVertical() {
+	if beginner == nil {
+		return
+	}
+	beginnerMu.Lock()
+	pilotVertical = true
+	beginnerMu.Unlock()
+}
+
+// checkBeginner enforces the ceiling and flight time limit, it is called from the flight data
+// loop with flightDataMu held and returns a message for the pilot, if any
+func checkBeginner(ev flightEvent, fd tello.FlightData) (msg string) {
+	b := beginner
+	if b == nil {
+		return ""
+	}
+	switch ev {
+	case takeOffEvent:
+		b.takeOff, b.warned, b.landing = time.Now(), false, false
+	case landingEvent:
+		b.landing = false
+	}
+	if !fd.Flying {
+		b.takeOff, b.descending = time.Time{}, false
+		return ""
+	}
+	if b.takeOff.IsZero() {
+		// already flying when we started, or the take off was missed
+		b.takeOff = time.Now()
+	}
+	switch {
+	case fd.Height > b.ceilingDm+beginnerCeilingMargin && !b.descending:
+		b.descending = true
+		beginnerMu.Lock()
+		pilotVertical = false
+		beginnerMu.Unlock()
+		drone.Down(beginnerDescendPct)
+		msg = "Beginner ceiling - descending"
+	case fd.Height <= b.ceilingDm && b.descending:
+		b.descending = false
+		beginnerMu.Lock()
+		piloted := pilotVertical
+		beginnerMu.Unlock()
+		if !piloted {
+			drone.Down(0)
+		}
+	}
+	if b.maxFlight > 0 && !b.landing {
+		left := b.maxFlight - time.Since(b.takeOff)
+		switch {
+		case left <= 0:
+			b.landing = true
+			commandIssued(beginnerSrc, "land")
+			drone.Land()
+			msg = "Beginner time limit - landing"
+		case left <= beginnerLandWarning && !b.warned:
+			b.warned = true
+			msg = fmt.Sprintf("Landing in %d seconds", int(left.Seconds()))
+		}
+	}
+	return msg
+}
+
+// beginnerText is shown in the status window, it must be called with flightDataMu held
+func beginnerText() string {
+	b := beginner
+	if b == nil {
+		return ""
+	}
+	s := fmt.Sprintf("BEGINNER MODE - Speed %d%%  Ceiling %.1fm", b.speedPct, float32(b.ceilingDm)/10)
+	if b.maxFlight > 0 {
+		if flightData.Flying && !b.takeOff.IsZero() {
+			left := b.maxFlight - time.Since(b.takeOff)
+			if left < 0 {
+				left = 0
+			}
+			s += fmt.Sprintf("  Landing in %s", left.Round(time.Second))
+		} else {
+			s += fmt.Sprintf("  Flight time %s", b.maxFlight)
+		}
+	}
+	return s
+}
@@ -0,0 +1,190 @@
+// bitrate.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// Adaptive bitrate steps the video bitrate down when the link looks poor and back up when it
+// has been good for a while.  Stepping up needs a longer run of good checks than stepping down
+// needs bad ones, so that we do not flap between two rates.
+
+const (
+	abrCheckPeriod  = 2 * time.Second
+	abrDownAfter    = 2 // consecutive bad checks before stepping down
+	abrUpAfter      = 5 // consecutive good checks before stepping up
+	abrMinWifi      = 50
+	abrMaxInterfere = 50
+	abrMaxDropped   = 0 // dropped frames allowed per check
+	autoBitrateName = "auto"
+)
+
+// the video bitrates we can choose between, slowest first
+var vbrLevels = []struct {
+	vbr  tello.VBR
+	name string
+}{
+	{tello.Vbr1M, "1"},
+	{tello.Vbr1M5, "1.5"},
+	{tello.Vbr2M, "2"},
+	{tello.Vbr3M, "3"},
+	{tello.Vbr4M, "4"},
+}
+
+var (
+	vbrMu       sync.Mutex
+	vbrLevel    int  // index into vbrLevels
+	vbrAuto     bool // adaptive mode
+	abrStarting sync.Once
+)
+
+// parseBitrate interprets the -bitrate flag
+func parseBitrate(s string) (level int, auto bool, err error) {
+	if s == autoBitrateName {
+		return len(vbrLevels) - 1, true, nil
+	}
+	for i, l := range vbrLevels {
+		if strings.TrimSuffix(s, "M") == l.name {
+			return i, false, nil
+		}
+	}
+	return 0, false, fmt.Errorf("unknown bitrate %q", s)
+}
+
+// setVideoBitrate sends the bitrate to the drone and remembers it
+func setVideoBitrate(level int) {
+	vbrMu.Lock()
+	vbrLevel = level
+	vbrMu.Unlock()
+	drone.SetVideoBitrate(vbrLevels[level].vbr)
+}
+
+func levelOf(vbr tello.VBR) int {
+	for i, l := range vbrLevels {
+		if l.vbr == vbr {
+			return i
+		}
+	}
+	return len(vbrLevels) - 1
+}
+
+func bitrateText() string {
+	vbrMu.Lock()
+	defer vbrMu.Unlock()
+	if vbrAuto {
+		return fmt.Sprintf("Bitrate: %sM (auto)", vbrLevels[vbrLevel].name)
+	}
+	return fmt.Sprintf("Bitrate: %sM", vbrLevels[vbrLevel].name)
+}
+
+// setBitrateAuto turns adaptive bitrate on or off
+func setBitrateAuto(auto bool) {
+	vbrMu.Lock()
+	vbrAuto = auto
+	vbrMu.Unlock()
+	if auto {
+		abrStarting.Do(startAdaptiveBitrate)
+	}
+}
+
+// The user chooses between the fixed rates and, after the fastest, auto.
+
+func bitrateChoice() int {
+	vbrMu.Lock()
+	defer vbrMu.Unlock()
+	if vbrAuto {
+		return len(vbrLevels)
+	}
+	return vbrLevel
+}
+
+func bitrateChoiceName(choice int) string {
+	if choice == len(vbrLevels) {
+		return autoBitrateName
+	}
+	return vbrLevels[choice].name + "M"
+}
+
+func setBitrateChoice(choice int) {
+	if choice == len(vbrLevels) {
+		setBitrateAuto(true)
+		return
+	}
+	setBitrateAuto(false)
+	setVideoBitrate(choice)
+}
+
+func startAdaptiveBitrate() {
+	go func() {
+		defer blackBoxOnPanic()
+		var good, bad int
+		lastDropped := inspector.getStats().dropped
+		for range time.Tick(abrCheckPeriod) {
+			flightDataMu.RLock()
+			heard := haveFlightData(&flightData)
+			wifi, interference := flightData.WifiStrength, flightData.WifiInterference
+			flightDataMu.RUnlock()
+			dropped := inspector.getStats().dropped
+			newDrops := dropped - lastDropped
+			lastDropped = dropped
+			if !heard {
+				// the WiFi strength reads as zero until the drone reports it
+				continue
+			}
+
+			if wifi < abrMinWifi || interference > abrMaxInterfere || newDrops > abrMaxDropped {
+				bad++
+				good = 0
+			} else {
+				good++
+				bad = 0
+			}
+
+			vbrMu.Lock()
+			level, auto := vbrLevel, vbrAuto
+			vbrMu.Unlock()
+			if !auto {
+				good, bad = 0, 0
+				continue
+			}
+			switch {
+			case bad >= abrDownAfter && level > 0:
+				level--
+			case good >= abrUpAfter && level < len(vbrLevels)-1:
+				level++
+			default:
+				continue
+			}
+			good, bad = 0, 0
+			log.Printf("Adaptive bitrate: WiFi %d, interference %d, dropped %d - changing to %sM\n",
+				wifi, interference, newDrops, vbrLevels[level].name)
+			setVideoBitrate(level)
+		}
+	}()
+}
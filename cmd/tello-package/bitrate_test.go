@@ -0,0 +1,54 @@
+// bitrate_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import "testing"
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		in    string
+		level int
+		auto  bool
+		err   bool
+	}{
+		{"1", 0, false, false},
+		{"1.5", 1, false, false},
+		{"1.5M", 1, false, false},
+		{"2", 2, false, false},
+		{"3M", 3, false, false},
+		{"4", 4, false, false},
+		{"auto", 4, true, false},
+		{"5", 0, false, true},
+		{"", 0, false, true},
+		{"Auto", 0, false, true},
+	}
+	for _, tc := range tests {
+		level, auto, err := parseBitrate(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("parseBitrate(%q) error = %v, want error %v", tc.in, err, tc.err)
+			continue
+		}
+		if err == nil && (level != tc.level || auto != tc.auto) {
+			t.Errorf("parseBitrate(%q) = %d, %v, want %d, %v", tc.in, level, auto, tc.level, tc.auto)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+// blackbox.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// The black box keeps the last minute or so of telemetry, stick inputs, commands and video
+// in memory and writes it all to disk when something goes wrong, so that there is always
+// evidence of what happened without having to record every flight in full.
+
+const (
+	bbLinkTimeout      = 2 * time.Second  // no flight data for this long means the link is lost
+	bbHeightLossDm     = 10               // a drop of this many decimetres...
+	bbHeightLossWindow = time.Second      // ...within this time is a sudden height loss
+	bbCrashHeightDm    = 5                // no longer flying above this height without being told to land is a crash
+	bbLandGrace        = 10 * time.Second // how long after a land command the drone may stop flying
+	bbDumpGap          = 10 * time.Second // incidents closer together than this share a dump
+)
+
+type bbFlightData struct {
+	Time time.Time
+	tello.FlightData
+}
+
+type bbSticks struct {
+	t time.Time
+	tello.StickMessage
+}
+
+type bbCommand struct {
+	t               time.Time
+	source, command string
+}
+
+type bbFrame struct {
+	t     time.Time
+	au    []byte
+	isKey bool
+}
+
+type blackBoxRecorder struct {
+	mu       sync.Mutex
+	window   time.Duration
+	dir      string
+	telem    []bbFlightData
+	sticks   []bbSticks
+	commands []bbCommand
+	frames   []bbFrame
+	lastFD   time.Time
+	linkLost bool
+	lastLand time.Time
+	lastDump time.Time
+	lastWhy  string
+
+	stickDescent bool      // the vertical stick is down
+	cmdDescent   bool      // a down command has not yet been stopped
+	lastDescent  time.Time // when a descent was last being commanded
+}
+
+var blackBox *blackBoxRecorder
+
+// startBlackBox starts recording, incidents are saved in a new directory under dir
+func startBlackBox(dir string, secs int) {
+	blackBox = &blackBoxRecorder{window: time.Duration(secs) * time.Second, dir: dir}
+	go blackBox.videoRecorder()
+	go blackBox.linkWatchdog()
+	log.Printf("Black box recording the last %d seconds, incidents will be saved in %s\n", secs, dir)
+}
+
+// recordFlightData is called with every flight data update and checks it for incidents
+func recordFlightData(prev, cur tello.FlightData) {
+	if blackBox == nil {
+		return
+	}
+	bb := blackBox
+	now := time.Now()
+	bb.mu.Lock()
+	bb.telem = append(bb.telem, bbFlightData{Time: now, FlightData: cur})
+	cutoff := now.Add(-bb.window)
+	for len(bb.telem) > 0 && bb.telem[0].Time.Before(cutoff) {
+		bb.telem = bb.telem[1:]
+	}
+	bb.lastFD = now
+	bb.linkLost = false
+	reason := ""
+	if bb.stickDescent || bb.cmdDescent {
+		bb.lastDescent = now
+	}
+	// the pilot may descend as fast as they like, only an unexpected drop is an incident
+	if cur.Flying && now.Sub(bb.lastDescent) > bbHeightLossWindow && now.Sub(bb.lastLand) > bbLandGrace {
+		// compare with the highest point in the last second
+		maxHt := cur.Height
+		for i := len(bb.telem) - 1; i >= 0 && now.Sub(bb.telem[i].Time) <= bbHeightLossWindow; i-- {
+			if bb.telem[i].Height > maxHt {
+				maxHt = bb.telem[i].Height
+			}
+		}
+		if maxHt-cur.Height >= bbHeightLossDm {
+			reason = "height-loss"
+		}
+	}
+	if prev.Flying && !cur.Flying && prev.Height > bbCrashHeightDm && now.Sub(bb.lastLand) > bbLandGrace {
+		reason = "crash"
+	}
+	if cur.EmOpen && !prev.EmOpen {
+		reason = "emergency-stop"
+	}
+	bb.mu.Unlock()
+	if reason != "" {
+		go bb.incident(reason)
+	}
+}
+
+// recordSticks is called with every stick update sent to the drone
+func recordSticks(sm tello.StickMessage) {
+	if blackBox == nil {
+		return
+	}
+	bb := blackBox
+	now := time.Now()
+	bb.mu.Lock()
+	bb.sticks = append(bb.sticks, bbSticks{t: now, StickMessage: sm})
+	bb.stickDescent = sm.Ly < 0
+	cutoff := now.Add(-bb.window)
+	for len(bb.sticks) > 0 && bb.sticks[0].t.Before(cutoff) {
+		bb.sticks = bb.sticks[1:]
+	}
+	bb.mu.Unlock()
+}
+
+// recordCommand is called with every command from any source
+func recordCommand(source, command string) {
+	if blackBox == nil {
+		return
+	}
+	bb := blackBox
+	now := time.Now()
+	bb.mu.Lock()
+	bb.commands = append(bb.commands, bbCommand{t: now, source: source, command: command})
+	cutoff := now.Add(-bb.window)
+	for len(bb.commands) > 0 && bb.commands[0].t.Before(cutoff) {
+		bb.commands = bb.commands[1:]
+	}
+	switch command {
+	case "land", "palm_land":
+		bb.lastLand = now
+	case "down":
+		bb.cmdDescent = true
+	case "up", "stop_up_down", "hover":
+		bb.cmdDescent = false
+	}
+	bb.mu.Unlock()
+}
+
+// blackBoxOnPanic saves the black box if the calling goroutine panics, it must be deferred
+func blackBoxOnPanic() {
+	if r := recover(); r != nil {
+		if blackBox != nil {
+			blackBox.incident(fmt.Sprintf("panic: %v", r))
+		}
+		panic(r)
+	}
+}
+
+// videoRecorder keeps enough video to cover the window, starting at a keyframe so that it can be played.
+// The drone only sends keyframes when asked, so one is requested every half window to keep the ring bounded.
+func (bb *blackBoxRecorder) videoRecorder() {
+	for {
+		vs := subscribeVideo("blackbox")
+		var lastKey time.Time
+		for au := range vs.frames {
+			now := time.Now()
+			isKey := containsIDR(au)
+			if isKey {
+				lastKey = now
+			} else if now.Sub(lastKey) > bb.window/2 {
+				vs.wantKeyframe()
+			}
+			bb.mu.Lock()
+			bb.frames = append(bb.frames, bbFrame{t: now, au: au, isKey: isKey})
+			bb.frames = trimFrames(bb.frames, now, bb.window)
+			bb.mu.Unlock()
+		}
+		// the resolution changed, older frames would not play with the new parameter sets
+		unsubscribeVideo(vs)
+		bb.mu.Lock()
+		bb.frames = nil
+		bb.mu.Unlock()
+	}
+}
+
+// trimFrames drops frames older than the window, except that it keeps back to the last keyframe before
+// it so that the start of the window can be decoded. If that keyframe is more than another window older
+// it starts at the first keyframe inside the window instead, or failing that at the window itself.
+func trimFrames(frames []bbFrame, now time.Time, window time.Duration) []bbFrame {
+	cutoff := now.Add(-window)
+	keep, first, firstKey := -1, -1, -1
+	for i, f := range frames {
+		if !f.t.After(cutoff) {
+			if f.isKey {
+				keep = i
+			}
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if f.isKey {
+			firstKey = i
+			break
+		}
+	}
+	switch {
+	case keep >= 0 && !frames[keep].t.Before(cutoff.Add(-window)):
+		return frames[keep:]
+	case firstKey >= 0:
+		return frames[firstKey:]
+	case first >= 0:
+		return frames[first:]
+	}
+	return frames[:0]
+}
+
+func (bb *blackBoxRecorder) linkWatchdog() {
+	for range time.Tick(bbLinkTimeout / 4) {
+		bb.mu.Lock()
+		lost := !bb.lastFD.IsZero() && !bb.linkLost && time.Since(bb.lastFD) > bbLinkTimeout
+		if lost {
+			bb.linkLost = true
+		}
+		bb.mu.Unlock()
+		if lost {
+			bb.incident("link-loss")
+		}
+	}
+}
+
+// incident saves the contents of the black box unless that has just been done,
+// a repeat of the incident that caused the last dump is ignored altogether
+func (bb *blackBoxRecorder) incident(reason string) {
+	now := time.Now()
+	bb.mu.Lock()
+	if now.Sub(bb.lastDump) < bbDumpGap {
+		repeat := reason == bb.lastWhy
+		bb.mu.Unlock()
+		if !repeat {
+			addIncident(reason)
+			log.Printf("Black box incident: %s (already saved)\n", reason)
+		}
+		return
+	}
+	bb.lastDump = now
+	bb.lastWhy = reason
+	telem := append([]bbFlightData(nil), bb.telem...)
+	sticks := append([]bbSticks(nil), bb.sticks...)
+	commands := append([]bbCommand(nil), bb.commands...)
+	frames := append([]bbFrame(nil), bb.frames...)
+	bb.mu.Unlock()
+
+	addIncident(reason)
+	log.Printf("Black box incident: %s\n", reason)
+	dir := filepath.Join(bb.dir, now.Format("2006-01-02-150405"))
+	if err := bb.dump(dir, reason, telem, sticks, commands, frames); err != nil {
+		log.Printf("Error saving black box - %v\n", err)
+		return
+	}
+	log.Printf("Black box saved in %s\n", dir)
+	addRecording("Black box: " + dir)
+}
+
+func (bb *blackBoxRecorder) dump(dir, reason string, telem []bbFlightData, sticks []bbSticks,
+	commands []bbCommand, frames []bbFrame) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	err := writeBBFile(filepath.Join(dir, "incident.txt"), func(w *bufio.Writer) error {
+		_, err := fmt.Fprintf(w, "Incident: %s\nTime: %s\n", reason, time.Now().Format(time.RFC3339))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = writeBBFile(filepath.Join(dir, "telemetry.jsonl"), func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for i := range telem {
+			if err := enc.Encode(&telem[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeBBFile(filepath.Join(dir, "sticks.csv"), func(w *bufio.Writer) error {
+		fmt.Fprintln(w, "time,rx,ry,lx,ly")
+		for _, s := range sticks {
+			fmt.Fprintf(w, "%s,%d,%d,%d,%d\n", s.t.Format(time.RFC3339Nano), s.Rx, s.Ry, s.Lx, s.Ly)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeBBFile(filepath.Join(dir, "commands.csv"), func(w *bufio.Writer) error {
+		fmt.Fprintln(w, "time,source,command")
+		for _, c := range commands {
+			fmt.Fprintf(w, "%s,%s,%s\n", c.t.Format(time.RFC3339Nano), c.source, c.command)
+		}
+		return nil
+	})
+	if err != nil || len(frames) == 0 {
+		return err
+	}
+	return writeBBFile(filepath.Join(dir, "video.h264"), func(w *bufio.Writer) error {
+		sps, pps := getParamSets()
+		w.Write(sps)
+		w.Write(pps)
+		for _, f := range frames {
+			if _, err := w.Write(f.au); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeBBFile(path string, write func(w *bufio.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err = write(w); err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+// charts.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nosdl
+// +build !nosdl
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// chart panel layout, the charts are stacked in a column to the right of the status text
+const (
+	chartX, chartTop           = 810, 40
+	chartW, chartH             = 380, 150
+	chartGap                   = 40
+	chartMinWifi, chartMaxWifi = 0, 100
+)
+
+var chartColour = sdl.Color{R: 0, G: 200, B: 200, A: 255}
+
+func drawCharts() {
+	snap := telemetry.snapshot()
+	secs := len(telemetry.samples) / chartSamplesPerSec
+	y := int32(chartTop)
+	drawChart(snap, func(s telemetrySample) float64 { return s.height }, "Height m", secs, y, 0, 0, false)
+	y += chartH + chartGap
+	drawChart(snap, func(s telemetrySample) float64 { return s.battery }, "Battery %", secs, y, 0, 100, true)
+	y += chartH + chartGap
+	drawChart(snap, func(s telemetrySample) float64 { return s.groundSpeed }, "Ground Speed m/s", secs, y, 0, 0, false)
+	y += chartH + chartGap
+	drawChart(snap, func(s telemetrySample) float64 { return s.wifiStrength }, "WiFi Strength", secs, y, chartMinWifi, chartMaxWifi, true)
+}
+
+// drawChart plots one value from the samples against time,
+// the y-axis is autoscaled unless fixedScale is set
+func drawChart(snap []telemetrySample, value func(telemetrySample) float64, title string, secs int, y int32, min, max float64, fixedScale bool) {
+	setDrawColour(hudColour)
+	renderer.DrawRect(&sdl.Rect{X: chartX, Y: y, W: chartW, H: chartH})
+	if len(snap) == 0 {
+		renderTextAt(title, smallFont, chartX, y-14)
+		return
+	}
+	if !fixedScale {
+		min, max = value(snap[0]), value(snap[0])
+		for _, s := range snap {
+			v := value(s)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+	}
+	if max-min < 1 {
+		max = min + 1
+	}
+	// the newest sample is always at the right-hand edge
+	capacity := float64(len(telemetry.samples))
+	startX := float64(chartX+chartW) - float64(len(snap))*float64(chartW)/capacity
+	points := make([]sdl.Point, len(snap))
+	for i, s := range snap {
+		v := value(s)
+		if v < min {
+			v = min
+		}
+		if v > max {
+			v = max
+		}
+		points[i] = sdl.Point{
+			X: int32(startX + float64(i)*float64(chartW)/capacity),
+			Y: y + chartH - 1 - int32((v-min)/(max-min)*float64(chartH-2)),
+		}
+	}
+	setDrawColour(chartColour)
+	renderer.DrawLines(points)
+	last := value(snap[len(snap)-1])
+	renderTextAt(fmt.Sprintf("%s: %.1f  (last %s)", title, last, time.Duration(secs)*time.Second), smallFont, chartX, y-14)
+	renderTextAt(fmt.Sprintf("%.0f", max), smallFont, chartX+chartW+2, y)
+	renderTextAt(fmt.Sprintf("%.0f", min), smallFont, chartX+chartW+2, y+chartH-12)
+}
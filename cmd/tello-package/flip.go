@@ -0,0 +1,94 @@
+// flip.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/SMerrony/tello-desktop/tellorpc"
+)
+
+// Every flip, whatever its source, goes through flip so that it can be refused when unsafe.
+// The Tello silently ignores flips when its battery is low, and a flip loses height.
+
+const (
+	flipMinHeightDm   = 10
+	flipMinBatteryPct = 50
+)
+
+// flipRefusal returns why a flip would be unsafe now, or nil
+func flipRefusal() error {
+	if beginnerMode() {
+		return errors.New("flips are disabled in beginner mode")
+	}
+	flightDataMu.RLock()
+	fd := flightData
+	flightDataMu.RUnlock()
+	switch {
+	case !fd.Flying:
+		return errors.New("not flying")
+	case fd.Height < flipMinHeightDm:
+		return fmt.Errorf("too low, need %.1fm", float32(flipMinHeightDm)/10)
+	case fd.BatteryPercentage < flipMinBatteryPct:
+		return fmt.Errorf("battery below %d%%", flipMinBatteryPct)
+	}
+	return nil
+}
+
+// the flip commands and their directions, a flip may be refused so it is only issued once carried out
+var flipCommands = map[string]string{
+	"flip_" + tellorpc.FlipForward:  tellorpc.FlipForward,
+	"flip_" + tellorpc.FlipBackward: tellorpc.FlipBackward,
+	"flip_" + tellorpc.FlipLeft:     tellorpc.FlipLeft,
+	"flip_" + tellorpc.FlipRight:    tellorpc.FlipRight,
+}
+
+var flipFuncs = map[string]func(){
+	tellorpc.FlipForward:  drone.ForwardFlip,
+	tellorpc.FlipBackward: drone.BackFlip,
+	tellorpc.FlipLeft:     drone.LeftFlip,
+	tellorpc.FlipRight:    drone.RightFlip,
+}
+
+// flip performs a flip in one of the tellorpc.Flip* directions, or returns why it was not done
+func flip(source, direction string) error {
+	doFlip, ok := flipFuncs[direction]
+	if !ok {
+		return fmt.Errorf("unknown flip direction %q", direction)
+	}
+	if err := flipRefusal(); err != nil {
+		return err
+	}
+	doFlip()
+	commandIssued(source, "flip_"+direction)
+	return nil
+}
+
+// uiFlip is a flip requested by the pilot, who is shown why it was refused
+func uiFlip(source, direction string) {
+	if err := flip(source, direction); err != nil {
+		log.Printf("Flip %s refused - %v\n", direction, err)
+		setFlightMsg("No flip: " + err.Error())
+	}
+}
@@ -0,0 +1,212 @@
+// grpc.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/SMerrony/tello"
+	"github.com/SMerrony/tello-desktop/tellorpc"
+)
+
+const rpcMinFlightDataPeriod = 50 * time.Millisecond
+
+// rpcServer implements tellorpc.TelloServer
+type rpcServer struct {
+	tellorpc.UnimplementedTelloServer
+}
+
+func startGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	tellorpc.RegisterTelloServer(s, rpcServer{})
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("gRPC server stopped - %v\n", err)
+		}
+	}()
+	log.Printf("gRPC server listening on %s\n", lis.Addr())
+	return nil
+}
+
+func okReply() (*tellorpc.CommandReply, error) {
+	return &tellorpc.CommandReply{Ok: true}, nil
+}
+
+func (rpcServer) TakeOff(ctx context.Context, req *tellorpc.Empty) (*tellorpc.CommandReply, error) {
+	drone.TakeOff()
+	commandIssued(grpcSrc, "takeoff")
+	return okReply()
+}
+
+func (rpcServer) Land(ctx context.Context, req *tellorpc.Empty) (*tellorpc.CommandReply, error) {
+	drone.Land()
+	commandIssued(grpcSrc, "land")
+	return okReply()
+}
+
+func (rpcServer) Flip(ctx context.Context, req *tellorpc.FlipRequest) (*tellorpc.CommandReply, error) {
+	if err := flip(grpcSrc, req.Direction); err != nil {
+		return &tellorpc.CommandReply{Message: err.Error()}, nil
+	}
+	return okReply()
+}
+
+func (rpcServer) TakePicture(ctx context.Context, req *tellorpc.Empty) (*tellorpc.CommandReply, error) {
+	drone.TakePicture()
+	commandIssued(grpcSrc, "photo")
+	return okReply()
+}
+
+func (rpcServer) SetVideoMode(ctx context.Context, req *tellorpc.VideoModeRequest) (*tellorpc.CommandReply, error) {
+	setVideoMode(req.Wide)
+	commandIssued(grpcSrc, "video_mode")
+	return okReply()
+}
+
+func (rpcServer) StreamFlightData(req *tellorpc.FlightDataRequest, stream tellorpc.Tello_StreamFlightDataServer) error {
+	period := time.Duration(req.PeriodMs) * time.Millisecond
+	if period < rpcMinFlightDataPeriod {
+		period = rpcMinFlightDataPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case t := <-ticker.C:
+			flightDataMu.RLock()
+			fd := rpcFlightData(t, flightData)
+			flightDataMu.RUnlock()
+			if err := stream.Send(fd); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rpcFlightData converts the drone's flight data to its gRPC message
+func rpcFlightData(t time.Time, fd tello.FlightData) *tellorpc.FlightData {
+	pitch, roll, yaw := tello.QuatToEulerDeg(fd.IMU.QuaternionX, fd.IMU.QuaternionY, fd.IMU.QuaternionZ, fd.IMU.QuaternionW)
+	return &tellorpc.FlightData{
+		Time:              timestamppb.New(t),
+		Flying:            fd.Flying,
+		OnGround:          fd.OnGround,
+		DroneHover:        fd.DroneHover,
+		EmOpen:            fd.EmOpen,
+		Height:            int32(fd.Height),
+		BatteryPercentage: int32(fd.BatteryPercentage),
+		BatteryLow:        fd.BatteryLow,
+		BatteryCritical:   fd.BatteryCritical,
+		BatteryMilliVolts: int32(fd.BatteryMilliVolts),
+		FlyTime:           int32(fd.FlyTime),
+		DroneFlyTimeLeft:  int32(fd.DroneFlyTimeLeft),
+		NorthSpeed:        int32(fd.NorthSpeed),
+		EastSpeed:         int32(fd.EastSpeed),
+		VerticalSpeed:     int32(fd.VerticalSpeed),
+		GroundSpeed:       int32(fd.GroundSpeed),
+		WifiStrength:      uint32(fd.WifiStrength),
+		WifiInterference:  uint32(fd.WifiInterference),
+		LightStrength:     uint32(fd.LightStrength),
+		OverTemp:          fd.OverTemp,
+		FlyMode:           uint32(fd.FlyMode),
+		MaxHeight:         uint32(fd.MaxHeight),
+		Ssid:              fd.SSID,
+		Version:           fd.Version,
+		Pitch:             int32(pitch),
+		Roll:              int32(roll),
+		Yaw:               int32(yaw),
+		PositionX:         fd.MVO.PositionX,
+		PositionY:         fd.MVO.PositionY,
+		PositionZ:         fd.MVO.PositionZ,
+	}
+}
+
+func (rpcServer) StreamSticks(stream tellorpc.Tello_StreamSticksServer) error {
+	var summary tellorpc.StickSummary
+	// always centre the sticks when the client goes away
+	defer remoteSticks(tello.StickMessage{})
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&summary)
+		}
+		if err != nil {
+			return err
+		}
+		remoteSticks(tello.StickMessage{Rx: rpcStick(in.Rx), Ry: rpcStick(in.Ry), Lx: rpcStick(in.Lx), Ly: rpcStick(in.Ly)})
+		summary.Received++
+	}
+}
+
+func (rpcServer) StreamVideo(req *tellorpc.Empty, stream tellorpc.Tello_StreamVideoServer) error {
+	name := "grpc-" + peerName(stream.Context())
+	vs := subscribeVideo(name)
+	defer func() { unsubscribeVideo(vs) }()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case au, ok := <-vs.frames:
+			if !ok {
+				// the format changed, the new parameter sets come with the next frame
+				vs = subscribeVideo(name)
+				continue
+			}
+			if err := stream.Send(&tellorpc.AccessUnit{Time: timestamppb.Now(), Data: au}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rpcStick limits a stick position to the range the drone takes
+func rpcStick(v int32) int16 {
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// peerName identifies the client of a stream for logging and metrics
+func peerName(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
@@ -0,0 +1,156 @@
+// h264.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+// H.264 NAL unit types which we need to recognise
+const (
+	nalSlice = 1
+	nalIDR   = 5
+	nalSEI   = 6
+	nalSPS   = 7
+	nalPPS   = 8
+	nalAUD   = 9
+)
+
+// nalSplitter reassembles the Annex-B byte stream received from the Tello, which arrives in
+// arbitrary sized pieces, into complete NAL units
+type nalSplitter struct {
+	buf     []byte
+	scanned int // how far we have already looked for a start code
+}
+
+// write adds video data from the drone and returns any NAL units (with their start codes)
+// that it completed
+func (ns *nalSplitter) write(data []byte) (nals [][]byte) {
+	ns.buf = append(ns.buf, data...)
+	i := ns.scanned
+	if i < 3 {
+		i = 3
+	}
+	for i+3 <= len(ns.buf) {
+		if ns.buf[i] != 0 || ns.buf[i+1] != 0 || ns.buf[i+2] != 1 {
+			i++
+			continue
+		}
+		// a 4-byte start code belongs to the following NAL unit
+		end := i
+		if ns.buf[i-1] == 0 {
+			end--
+		}
+		nals = append(nals, ns.buf[:end])
+		ns.buf = ns.buf[end:]
+		i = 3
+	}
+	ns.scanned = i
+	return nals
+}
+
+// nalHeaderOffset returns the index of the NAL header byte after the start code, or -1
+func nalHeaderOffset(nal []byte) int {
+	for i := 0; i+1 < len(nal); i++ {
+		if nal[i] == 1 {
+			return i + 1
+		}
+		if nal[i] != 0 {
+			return -1
+		}
+	}
+	return -1
+}
+
+func nalType(nal []byte) int {
+	if h := nalHeaderOffset(nal); h >= 0 {
+		return int(nal[h] & 0x1F)
+	}
+	return -1
+}
+
+// isFirstSlice reports whether a slice NAL unit begins a new picture, ie. first_mb_in_slice is
+// zero, which is encoded as a single set bit at the start of the slice header
+func isFirstSlice(nal []byte) bool {
+	h := nalHeaderOffset(nal)
+	return h >= 0 && h+1 < len(nal) && nal[h+1]&0x80 != 0
+}
+
+// auAssembler groups NAL units into access units (complete frames with any parameter sets)
+type auAssembler struct {
+	au       []byte
+	hasSlice bool
+}
+
+// add returns the previous access unit when the given NAL unit starts a new one
+func (aa *auAssembler) add(nal []byte) (complete []byte) {
+	t := nalType(nal)
+	if aa.hasSlice {
+		switch t {
+		case nalAUD, nalSPS, nalPPS, nalSEI:
+			complete = aa.au
+		case nalSlice, nalIDR:
+			if isFirstSlice(nal) {
+				complete = aa.au
+			}
+		}
+		if complete != nil {
+			aa.au, aa.hasSlice = nil, false
+		}
+	}
+	aa.au = append(aa.au, nal...)
+	if t == nalSlice || t == nalIDR {
+		aa.hasSlice = true
+	}
+	return complete
+}
+
+// splitAnnexB returns the NAL units in an access unit without their start codes
+func splitAnnexB(au []byte) (nals [][]byte) {
+	start := -1
+	for i := 0; i+3 <= len(au); i++ {
+		if au[i] != 0 || au[i+1] != 0 || au[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			if au[i-1] == 0 {
+				end--
+			}
+			if end > start {
+				nals = append(nals, au[start:end])
+			}
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(au) {
+		nals = append(nals, au[start:])
+	}
+	return nals
+}
+
+// containsIDR reports whether an access unit holds a keyframe
+func containsIDR(au []byte) bool {
+	for _, nal := range splitAnnexB(au) {
+		if nal[0]&0x1F == nalIDR {
+			return true
+		}
+	}
+	return false
+}
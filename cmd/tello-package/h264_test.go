@@ -0,0 +1,101 @@
+// h264_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	testSPS   = []byte{0, 0, 0, 1, 0x67, 0x42, 0xC0, 0x28}
+	testPPS   = []byte{0, 0, 0, 1, 0x68, 0xCE, 0x3C, 0x80}
+	testIDR   = []byte{0, 0, 1, 0x65, 0x88, 0x84, 0x21}
+	testP     = []byte{0, 0, 0, 1, 0x41, 0x9A, 0x02}
+	testPCont = []byte{0, 0, 1, 0x41, 0x40, 0x11} // first_mb_in_slice is not zero
+	testAUD   = []byte{0, 0, 0, 1, 0x09, 0xF0}
+	testTail  = []byte{0, 0, 0, 1, 0x41, 0x9A, 0x03}
+)
+
+func testStream() []byte {
+	return bytes.Join([][]byte{testSPS, testPPS, testIDR, testP, testPCont, testAUD, testTail}, nil)
+}
+
+func TestNALSplitter(t *testing.T) {
+	stream := testStream()
+	// the last NAL unit is only complete when the next start code arrives
+	want := [][]byte{testSPS, testPPS, testIDR, testP, testPCont, testAUD}
+	for _, chunk := range []int{1, 2, 3, 4, 5, 7, len(stream)} {
+		var ns nalSplitter
+		var got [][]byte
+		for i := 0; i < len(stream); i += chunk {
+			end := i + chunk
+			if end > len(stream) {
+				end = len(stream)
+			}
+			for _, nal := range ns.write(stream[i:end]) {
+				got = append(got, append([]byte(nil), nal...))
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("chunks of %d: got %d NAL units, want %d", chunk, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Errorf("chunks of %d: NAL unit %d is % X, want % X", chunk, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestAUAssembler(t *testing.T) {
+	var aa auAssembler
+	var aus [][]byte
+	for _, nal := range [][]byte{testSPS, testPPS, testIDR, testP, testPCont, testAUD, testTail} {
+		if au := aa.add(nal); au != nil {
+			aus = append(aus, au)
+		}
+	}
+	want := []struct {
+		au  []byte
+		idr bool
+		n   int
+	}{
+		{bytes.Join([][]byte{testSPS, testPPS, testIDR}, nil), true, 3},
+		{bytes.Join([][]byte{testP, testPCont}, nil), false, 2},
+	}
+	if len(aus) != len(want) {
+		t.Fatalf("got %d access units, want %d", len(aus), len(want))
+	}
+	for i, w := range want {
+		if !bytes.Equal(aus[i], w.au) {
+			t.Errorf("access unit %d is % X, want % X", i, aus[i], w.au)
+		}
+		if containsIDR(aus[i]) != w.idr {
+			t.Errorf("access unit %d: containsIDR = %v, want %v", i, !w.idr, w.idr)
+		}
+		if n := len(splitAnnexB(aus[i])); n != w.n {
+			t.Errorf("access unit %d has %d NAL units, want %d", i, n, w.n)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// hud.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nosdl
+// +build !nosdl
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"github.com/SMerrony/tello"
+)
+
+// instrument panel layout, all instruments sit in a row below the text status
+const (
+	hudTop, hudSize          = 600, 180
+	horizonX, compassX       = 20, 215
+	altTapeX, altTapeW       = 410, 80
+	speedVecX, batteryX      = 510, 710
+	batteryW                 = 60
+	altTapeRange             = 40  // decimetres shown above & below the pointer
+	speedVecRange            = 1.0 // m/s at the edge of the speed vector box
+	pitchPixelsPerDeg        = 2
+	batteryWarn, batteryCrit = 50, 25
+)
+
+var (
+	renderer     *sdl.Renderer
+	skyColour    = sdl.Color{R: 40, G: 90, B: 200, A: 255}
+	groundColour = sdl.Color{R: 130, G: 80, B: 30, A: 255}
+	hudColour    = sdl.Color{R: 255, G: 255, B: 255, A: 255}
+	okColour     = sdl.Color{R: 0, G: 200, B: 0, A: 255}
+	warnColour   = sdl.Color{R: 255, G: 191, B: 0, A: 255}
+	critColour   = sdl.Color{R: 220, G: 0, B: 0, A: 255}
+)
+
+// hudData is the snapshot of flight data needed to draw the instruments
+type hudData struct {
+	pitch, roll, yaw      int
+	height                int16
+	northSpeed, eastSpeed float64 // m/s
+	battery               int8
+}
+
+// getHudData must be called with flightDataMu held
+func getHudData() (hd hudData) {
+	hd.pitch, hd.roll, hd.yaw = tello.QuatToEulerDeg(flightData.IMU.QuaternionX, flightData.IMU.QuaternionY,
+		flightData.IMU.QuaternionZ, flightData.IMU.QuaternionW)
+	hd.height = flightData.Height
+	hd.northSpeed = speedMS(flightData.NorthSpeed)
+	hd.eastSpeed = speedMS(flightData.EastSpeed)
+	hd.battery = flightData.BatteryPercentage
+	return hd
+}
+
+func drawHud(hd hudData) {
+	drawHorizon(horizonX, hudTop, hudSize, hd.pitch, hd.roll)
+	drawCompass(compassX, hudTop, hudSize, hd.yaw)
+	drawAltTape(altTapeX, hudTop, altTapeW, hudSize, hd.height)
+	drawSpeedVector(speedVecX, hudTop, hudSize, hd.northSpeed, hd.eastSpeed)
+	drawBatteryBar(batteryX, hudTop, batteryW, hudSize, hd.battery)
+}
+
+func setDrawColour(c sdl.Color) {
+	renderer.SetDrawColor(c.R, c.G, c.B, c.A)
+}
+
+// drawHorizon draws an artificial horizon in the square at x,y,
+// the ground/sky boundary is computed for each column so that roll and pitch are both shown
+func drawHorizon(x, y, size int32, pitch, roll int) {
+	cx, cy := x+size/2, y+size/2
+	tanRoll := math.Tan(float64(roll) * math.Pi / 180)
+	for col := x; col < x+size; col++ {
+		horizY := int32(float64(cy) + float64(pitch*pitchPixelsPerDeg) + float64(col-cx)*tanRoll)
+		if horizY < y {
+			horizY = y
+		}
+		if horizY > y+size {
+			horizY = y + size
+		}
+		if horizY > y {
+			setDrawColour(skyColour)
+			renderer.DrawLine(col, y, col, horizY-1)
+		}
+		if horizY < y+size {
+			setDrawColour(groundColour)
+			renderer.DrawLine(col, horizY, col, y+size-1)
+		}
+	}
+	// fixed aircraft symbol
+	setDrawColour(hudColour)
+	renderer.DrawLine(cx-40, cy, cx-10, cy)
+	renderer.DrawLine(cx+10, cy, cx+40, cy)
+	renderer.DrawLine(cx-10, cy, cx, cy+8)
+	renderer.DrawLine(cx, cy+8, cx+10, cy)
+	renderer.DrawRect(&sdl.Rect{X: x, Y: y, W: size, H: size})
+	renderTextAt(fmt.Sprintf("P%+d R%+d", pitch, roll), smallFont, x+2, y+size+2)
+}
+
+// drawCompass draws a compass rose with the needle pointing in the current yaw direction
+func drawCompass(x, y, size int32, yaw int) {
+	cx, cy := float64(x+size/2), float64(y+size/2)
+	radius := float64(size/2) - 2
+	setDrawColour(hudColour)
+	var prevX, prevY int32
+	for deg := 0; deg <= 360; deg += 5 {
+		rad := float64(deg) * math.Pi / 180
+		px, py := int32(cx+radius*math.Sin(rad)), int32(cy-radius*math.Cos(rad))
+		if deg > 0 {
+			renderer.DrawLine(prevX, prevY, px, py)
+		}
+		prevX, prevY = px, py
+		if deg%30 == 0 {
+			inner := radius - 8
+			renderer.DrawLine(px, py, int32(cx+inner*math.Sin(rad)), int32(cy-inner*math.Cos(rad)))
+		}
+	}
+	renderTextAt("N", smallFont, int32(cx)-3, y+10)
+	rad := float64(yaw) * math.Pi / 180
+	setDrawColour(warnColour)
+	renderer.DrawLine(int32(cx), int32(cy), int32(cx+(radius-12)*math.Sin(rad)), int32(cy-(radius-12)*math.Cos(rad)))
+	renderTextAt(fmt.Sprintf("Hdg %03d", (yaw+360)%360), smallFont, x+size/2-25, y+size+2)
+}
+
+// drawAltTape draws a vertical scale centred on the current height with a tick every half metre
+func drawAltTape(x, y, w, h int32, height int16) {
+	cy := y + h/2
+	pxPerDm := float64(h) / float64(2*altTapeRange)
+	setDrawColour(hudColour)
+	renderer.DrawRect(&sdl.Rect{X: x, Y: y, W: w, H: h})
+	first := (int(height) - altTapeRange) / 5 * 5
+	for dm := first; dm <= int(height)+altTapeRange; dm += 5 {
+		ty := cy - int32(float64(dm-int(height))*pxPerDm)
+		if ty <= y || ty >= y+h {
+			continue
+		}
+		if dm%10 == 0 {
+			renderer.DrawLine(x, ty, x+15, ty)
+			if ty > y+6 && ty < y+h-14 {
+				renderTextAt(fmt.Sprintf("%d", dm/10), smallFont, x+20, ty-6)
+			}
+		} else {
+			renderer.DrawLine(x, ty, x+8, ty)
+		}
+	}
+	setDrawColour(warnColour)
+	renderer.DrawLine(x, cy, x+w-1, cy)
+	renderTextAt(fmt.Sprintf("Alt %.1fm", float32(height)/10), smallFont, x, y+h+2)
+}
+
+// drawSpeedVector draws a line from the centre of a box in the direction of travel
+func drawSpeedVector(x, y, size int32, north, east float64) {
+	cx, cy := x+size/2, y+size/2
+	scale := float64(size/2) / speedVecRange
+	setDrawColour(hudColour)
+	renderer.DrawRect(&sdl.Rect{X: x, Y: y, W: size, H: size})
+	renderer.DrawLine(cx, y, cx, y+size-1)
+	renderer.DrawLine(x, cy, x+size-1, cy)
+	vx := clampInt32(int32(east*scale), -size/2, size/2)
+	vy := clampInt32(int32(north*scale), -size/2, size/2)
+	setDrawColour(warnColour)
+	renderer.DrawLine(cx, cy, cx+vx, cy-vy)
+	renderer.FillRect(&sdl.Rect{X: cx + vx - 2, Y: cy - vy - 2, W: 5, H: 5})
+	renderTextAt(fmt.Sprintf("N%+.1f E%+.1f", north, east), smallFont, x+2, y+size+2)
+}
+
+// drawBatteryBar draws a vertical gauge which changes colour as the battery runs down
+func drawBatteryBar(x, y, w, h int32, pct int8) {
+	p := clampInt32(int32(pct), 0, 100)
+	fill := h * p / 100
+	switch {
+	case p < batteryCrit:
+		setDrawColour(critColour)
+	case p < batteryWarn:
+		setDrawColour(warnColour)
+	default:
+		setDrawColour(okColour)
+	}
+	renderer.FillRect(&sdl.Rect{X: x, Y: y + h - fill, W: w, H: fill})
+	setDrawColour(hudColour)
+	renderer.DrawRect(&sdl.Rect{X: x, Y: y, W: w, H: h})
+	renderer.FillRect(&sdl.Rect{X: x + w/3, Y: y - 6, W: w / 3, H: 6})
+	renderTextAt(fmt.Sprintf("%d%%", p), smallFont, x+w/2-10, y+h+2)
+}
+
+func clampInt32(v, min, max int32) int32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,355 @@
+// inspector.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// The video inspector parses the H.264 stream as it arrives so that we can tell whether stutter
+// is caused by the drone (low frame rate, long keyframe intervals), the WiFi (dropped frames,
+// corrupt NAL units) or the player (good stats but poor display).
+
+const (
+	inspectorPeriod    = time.Second
+	inspectorLogPeriod = 10 * time.Second
+)
+
+var errBitstream = errors.New("H.264 bitstream too short")
+
+// bitReader reads an RBSP, ie. a NAL unit payload with emulation prevention bytes removed
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+}
+
+func newBitReader(payload []byte) *bitReader {
+	rbsp := make([]byte, 0, len(payload))
+	zeros := 0
+	for _, b := range payload {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return &bitReader{buf: rbsp}
+}
+
+func (br *bitReader) u(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if br.pos >= len(br.buf)*8 {
+			return 0, errBitstream
+		}
+		bit := (br.buf[br.pos/8] >> uint(7-br.pos%8)) & 1
+		v = v<<1 | uint32(bit)
+		br.pos++
+	}
+	return v, nil
+}
+
+// ue reads an unsigned Exp-Golomb code
+func (br *bitReader) ue() (uint32, error) {
+	zeros := 0
+	for {
+		b, err := br.u(1)
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, errBitstream
+		}
+	}
+	rest, err := br.u(zeros)
+	return (1 << uint(zeros)) - 1 + rest, err
+}
+
+// se reads a signed Exp-Golomb code
+func (br *bitReader) se() (int32, error) {
+	v, err := br.ue()
+	if v&1 == 1 {
+		return int32(v/2) + 1, err
+	}
+	return -int32(v / 2), err
+}
+
+// spsInfo holds the fields of a sequence parameter set which we need
+type spsInfo struct {
+	profile, level       uint32
+	width, height        int
+	log2MaxFrameNum      uint32
+	separateColourPlanes bool
+}
+
+// parseSPS decodes an SPS NAL unit payload (without start code)
+func parseSPS(nal []byte) (sps spsInfo, err error) {
+	br := newBitReader(nal[1:])
+	// we only check the error from the last read since a short SPS fails everything after it
+	sps.profile, _ = br.u(8)
+	br.u(8) // constraint flags
+	sps.level, _ = br.u(8)
+	br.ue() // seq_parameter_set_id
+	chromaFormat := uint32(1)
+	switch sps.profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat, _ = br.ue()
+		if chromaFormat == 3 {
+			sep, _ := br.u(1)
+			sps.separateColourPlanes = sep == 1
+		}
+		br.ue() // bit_depth_luma_minus8
+		br.ue() // bit_depth_chroma_minus8
+		br.u(1) // qpprime_y_zero_transform_bypass_flag
+		if scaling, _ := br.u(1); scaling == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if present, _ := br.u(1); present == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(br, size)
+				}
+			}
+		}
+	}
+	l2mfn, _ := br.ue()
+	sps.log2MaxFrameNum = l2mfn + 4
+	pocType, _ := br.ue()
+	switch pocType {
+	case 0:
+		br.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		br.u(1) // delta_pic_order_always_zero_flag
+		br.se() // offset_for_non_ref_pic
+		br.se() // offset_for_top_to_bottom_field
+		n, _ := br.ue()
+		for i := uint32(0); i < n && i < 256; i++ {
+			br.se()
+		}
+	}
+	br.ue() // max_num_ref_frames
+	br.u(1) // gaps_in_frame_num_value_allowed_flag
+	wMbs, _ := br.ue()
+	hMapUnits, _ := br.ue()
+	frameMbsOnly, _ := br.u(1)
+	if frameMbsOnly == 0 {
+		br.u(1) // mb_adaptive_frame_field_flag
+	}
+	br.u(1) // direct_8x8_inference_flag
+	sps.width = int(wMbs+1) * 16
+	sps.height = int(2-frameMbsOnly) * int(hMapUnits+1) * 16
+	cropping, err := br.u(1)
+	if err != nil {
+		return sps, err
+	}
+	if cropping == 1 {
+		l, _ := br.ue()
+		r, _ := br.ue()
+		t, _ := br.ue()
+		b, err := br.ue()
+		if err != nil {
+			return sps, err
+		}
+		cropX, cropY := 1, int(2-frameMbsOnly)
+		switch chromaFormat {
+		case 1:
+			cropX, cropY = 2, cropY*2
+		case 2:
+			cropX = 2
+		}
+		if sps.separateColourPlanes {
+			cropX, cropY = 1, int(2-frameMbsOnly)
+		}
+		sps.width -= cropX * int(l+r)
+		sps.height -= cropY * int(t+b)
+	}
+	return sps, nil
+}
+
+func skipScalingList(br *bitReader, size int) {
+	last, next := int32(8), int32(8)
+	for j := 0; j < size; j++ {
+		if next != 0 {
+			delta, _ := br.se()
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// videoStats is the output of the inspector
+type videoStats struct {
+	width, height    int
+	fps              float64
+	bitsPerSec       float64
+	keyframeInterval int // in frames
+	dropped, corrupt int
+}
+
+func (vs videoStats) String() string {
+	res := "?x?"
+	if vs.width > 0 {
+		res = fmt.Sprintf("%dx%d", vs.width, vs.height)
+	}
+	return fmt.Sprintf("Video: %s %.1ffps %.2fMb/s GOP %d Dropped %d Corrupt %d",
+		res, vs.fps, vs.bitsPerSec/1e6, vs.keyframeInterval, vs.dropped, vs.corrupt)
+}
+
+// videoInspector accumulates statistics from the NAL units passing through the video goroutine
+type videoInspector struct {
+	mu            sync.Mutex
+	stats         videoStats
+	sps           *spsInfo
+	bytes, frames int // in the current period
+	sinceKeyframe int
+	expFrameNum   uint32
+	haveFrameNum  bool
+}
+
+var inspector videoInspector
+
+func (vi *videoInspector) addBytes(n int) {
+	vi.mu.Lock()
+	vi.bytes += n
+	vi.mu.Unlock()
+}
+
+func (vi *videoInspector) addNAL(nal []byte) {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+	h := nalHeaderOffset(nal)
+	if h < 0 || h+1 >= len(nal) || nal[h]&0x80 != 0 {
+		// no start code, or the forbidden_zero_bit is set
+		vi.stats.corrupt++
+		lostSync()
+		return
+	}
+	payload := nal[h:]
+	switch payload[0] & 0x1F {
+	case nalSPS:
+		sps, err := parseSPS(payload)
+		if err != nil {
+			vi.stats.corrupt++
+			return
+		}
+		vi.sps = &sps
+		vi.stats.width, vi.stats.height = sps.width, sps.height
+	case nalIDR, nalSlice:
+		vi.addSlice(payload)
+	}
+}
+
+// addSlice must be called with vi.mu held, frame_num gaps indicate dropped frames
+func (vi *videoInspector) addSlice(payload []byte) {
+	br := newBitReader(payload[1:])
+	firstMb, err := br.ue()
+	if err != nil {
+		vi.stats.corrupt++
+		return
+	}
+	if firstMb != 0 {
+		return // not the first slice of a picture
+	}
+	vi.frames++
+	isIDR := payload[0]&0x1F == nalIDR
+	if isIDR {
+		if vi.sinceKeyframe > 0 {
+			vi.stats.keyframeInterval = vi.sinceKeyframe
+		}
+		vi.sinceKeyframe = 0
+	}
+	vi.sinceKeyframe++
+	if vi.sps == nil {
+		return
+	}
+	br.ue() // slice_type
+	br.ue() // pic_parameter_set_id
+	if vi.sps.separateColourPlanes {
+		br.u(2)
+	}
+	frameNum, err := br.u(int(vi.sps.log2MaxFrameNum))
+	if err != nil {
+		vi.stats.corrupt++
+		return
+	}
+	maxFrameNum := uint32(1) << vi.sps.log2MaxFrameNum
+	if !isIDR && vi.haveFrameNum && frameNum != vi.expFrameNum {
+		vi.stats.dropped += int((frameNum - vi.expFrameNum + maxFrameNum) % maxFrameNum)
+		lostSync()
+	}
+	// frame_num only advances after reference pictures
+	if payload[0]&0x60 != 0 {
+		vi.expFrameNum = (frameNum + 1) % maxFrameNum
+	} else {
+		vi.expFrameNum = frameNum
+	}
+	vi.haveFrameNum = true
+}
+
+// tick computes the rates for the period just ended
+func (vi *videoInspector) tick(period time.Duration) {
+	vi.mu.Lock()
+	vi.stats.fps = float64(vi.frames) / period.Seconds()
+	vi.stats.bitsPerSec = float64(vi.bytes*8) / period.Seconds()
+	vi.frames, vi.bytes = 0, 0
+	vi.mu.Unlock()
+}
+
+func (vi *videoInspector) getStats() videoStats {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+	return vi.stats
+}
+
+func startInspector() {
+	go func() {
+		defer blackBoxOnPanic()
+		lastLog := time.Now()
+		for range time.Tick(inspectorPeriod) {
+			inspector.tick(inspectorPeriod)
+			if time.Since(lastLog) >= inspectorLogPeriod {
+				log.Println(inspector.getStats())
+				lastLog = time.Now()
+			}
+		}
+	}()
+}
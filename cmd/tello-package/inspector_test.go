@@ -0,0 +1,63 @@
+// inspector_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import "testing"
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		nal           []byte
+		profile       uint32
+		width, height int
+	}{
+		// the Tello's normal mode, baseline profile
+		{"960x720", []byte{0x67, 0x42, 0xC0, 0x28, 0xDA, 0x03, 0xC0, 0x5B, 0x90}, 66, 960, 720},
+		// high profile with 1088 lines cropped to 1080
+		{"1920x1080", []byte{0x67, 0x64, 0x00, 0x2A, 0xAC, 0xD9, 0x40, 0x78, 0x02, 0x27, 0xE5, 0x40}, 100, 1920, 1080},
+	}
+	for _, tc := range tests {
+		sps, err := parseSPS(tc.nal)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if sps.profile != tc.profile || sps.width != tc.width || sps.height != tc.height {
+			t.Errorf("%s: got profile %d %dx%d, want profile %d %dx%d", tc.name,
+				sps.profile, sps.width, sps.height, tc.profile, tc.width, tc.height)
+		}
+	}
+	if _, err := parseSPS([]byte{0x67, 0x42, 0xC0, 0x28, 0xDA}); err == nil {
+		t.Error("truncated SPS: no error")
+	}
+}
+
+func TestBitReaderEmulationPrevention(t *testing.T) {
+	// 00 00 03 01 is 00 00 01 once the emulation prevention byte is removed
+	br := newBitReader([]byte{0x00, 0x00, 0x03, 0x01})
+	if v, err := br.u(24); err != nil || v != 1 {
+		t.Errorf("got %#x, %v, want 0x1", v, err)
+	}
+	if _, err := br.u(1); err == nil {
+		t.Error("read past the end: no error")
+	}
+}
@@ -0,0 +1,275 @@
+// logbook.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The logbook is a small embedded database with an entry for every session in which the
+// drone was connected, for keeping track of hours flown and of incidents.
+// It is only opened briefly when a session ends, so that it can be read while flying.
+
+const (
+	defaultLogbook = "tello-logbook.db"
+	logbookDateFmt = "2006-01-02"
+	logbookTimeout = time.Second
+)
+
+var logbookBucket = []byte("sessions")
+
+type logEntry struct {
+	Start, End   time.Time
+	SSID         string
+	Version      string
+	Battery      string // label of the pack, if known
+	Flights      []flightRecord
+	Airtime      time.Duration
+	BatteryStart int8
+	BatteryEnd   int8
+	MaxHeight    int16 // dm
+	Incidents    []sessionWarning
+}
+
+// getLogEntry summarises the session so far, ok is false if the drone never reported its SSID or battery
+func getLogEntry() (le logEntry, ok bool) {
+	flightDataMu.RLock()
+	le.SSID, le.Version = flightData.SSID, flightData.Version
+	flightDataMu.RUnlock()
+	le.Battery = batteryLabel()
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	le.Start, le.End = session.start, time.Now()
+	le.Flights = append(le.Flights, session.flights...)
+	le.Airtime = session.airtime()
+	le.BatteryStart, le.BatteryEnd = session.batteryStart, session.batteryEnd
+	le.MaxHeight = session.maxHeight
+	le.Incidents = append(le.Incidents, session.incidents...)
+	return le, le.SSID != "" || le.BatteryStart != 0
+}
+
+// saveLogbook adds this session to the logbook in the given file
+func saveLogbook(path string) {
+	le, ok := getLogEntry()
+	if !ok {
+		return
+	}
+	val, err := json.Marshal(&le)
+	if err != nil {
+		log.Printf("Error encoding logbook entry - %v\n", err)
+		return
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: logbookTimeout})
+	if err != nil {
+		log.Printf("Error opening logbook %s - %v\n", path, err)
+		return
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(logbookBucket)
+		if err != nil {
+			return err
+		}
+		// keys sort in time order
+		return b.Put([]byte(le.Start.UTC().Format(time.RFC3339Nano)), val)
+	})
+	if err != nil {
+		log.Printf("Error writing logbook %s - %v\n", path, err)
+		return
+	}
+	fmt.Printf("Session added to logbook %s\n", path)
+}
+
+// logbookFilter selects entries for listing or export
+type logbookFilter struct {
+	drone        string
+	since, until time.Time
+	flownOnly    bool
+	incidentOnly bool
+}
+
+func (lf logbookFilter) match(le *logEntry) bool {
+	switch {
+	case lf.drone != "" && !strings.EqualFold(lf.drone, le.SSID):
+		return false
+	case !lf.since.IsZero() && le.Start.Before(lf.since):
+		return false
+	case !lf.until.IsZero() && !le.Start.Before(lf.until):
+		return false
+	case lf.flownOnly && len(le.Flights) == 0:
+		return false
+	case lf.incidentOnly && len(le.Incidents) == 0:
+		return false
+	}
+	return true
+}
+
+func readLogbook(path string, lf logbookFilter) (entries []logEntry, err error) {
+	if _, err = os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: logbookTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logbookBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var le logEntry
+			if err := json.Unmarshal(v, &le); err != nil {
+				return fmt.Errorf("bad entry %s - %v", k, err)
+			}
+			if lf.match(&le) {
+				entries = append(entries, le)
+			}
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// runLogbook implements the logbook subcommand
+func runLogbook(args []string) {
+	fs := flag.NewFlagSet("logbook", flag.ExitOnError)
+	dbFlag := fs.String("db", defaultLogbook, "Logbook file")
+	droneFlag := fs.String("drone", "", "Only show sessions with the drone with this SSID")
+	sinceFlag := fs.String("since", "", "Only show sessions on or after this date (YYYY-MM-DD)")
+	untilFlag := fs.String("until", "", "Only show sessions before this date (YYYY-MM-DD)")
+	flownFlag := fs.Bool("flown", false, "Only show sessions with at least one flight")
+	incidentFlag := fs.Bool("incidents", false, "Only show sessions with incidents")
+	formatFlag := fs.String("format", "csv", "Export format <csv|json>")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s logbook [options] [list|export|batteries]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.Arg(0) == "batteries" {
+		if err := listBatteries(*dbFlag); err != nil {
+			log.Fatalf("Unable to read logbook - %v", err)
+		}
+		return
+	}
+
+	lf := logbookFilter{drone: *droneFlag, flownOnly: *flownFlag, incidentOnly: *incidentFlag}
+	var err error
+	if *sinceFlag != "" {
+		if lf.since, err = time.ParseInLocation(logbookDateFmt, *sinceFlag, time.Local); err != nil {
+			log.Fatalf("Bad -since date - %v", err)
+		}
+	}
+	if *untilFlag != "" {
+		if lf.until, err = time.ParseInLocation(logbookDateFmt, *untilFlag, time.Local); err != nil {
+			log.Fatalf("Bad -until date - %v", err)
+		}
+	}
+	entries, err := readLogbook(*dbFlag, lf)
+	if err != nil {
+		log.Fatalf("Unable to read logbook - %v", err)
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		listLogbook(entries)
+	case "export":
+		switch *formatFlag {
+		case "csv":
+			err = exportLogbookCSV(entries)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(entries)
+		default:
+			log.Fatalf("Export format must be csv or json, got %s", *formatFlag)
+		}
+		if err != nil {
+			log.Fatalf("Error exporting logbook - %v", err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func listLogbook(entries []logEntry) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Date\tDrone\tFirmware\tFlights\tAirtime\tPack\tBattery\tMax Height\tIncidents")
+	var total time.Duration
+	var flights int
+	for _, le := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d%% - %d%%\t%.1fm\t%s\n",
+			le.Start.Local().Format("2006-01-02 15:04"), le.SSID, le.Version, len(le.Flights),
+			le.Airtime.Round(time.Second), le.Battery, le.BatteryStart, le.BatteryEnd, float32(le.MaxHeight)/10,
+			incidentSummary(le.Incidents))
+		total += le.Airtime
+		flights += len(le.Flights)
+	}
+	tw.Flush()
+	fmt.Printf("\n%d sessions, %d flights, total airtime %s\n", len(entries), flights, total.Round(time.Second))
+}
+
+func incidentSummary(incidents []sessionWarning) string {
+	if len(incidents) == 0 {
+		return "-"
+	}
+	var reasons []string
+	for _, inc := range incidents {
+		reasons = append(reasons, inc.Msg)
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// exportLogbookCSV writes one row per flight, which is what hours tracking needs
+func exportLogbookCSV(entries []logEntry) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"session", "drone", "firmware", "battery", "takeoff", "landing", "seconds",
+		"battery_takeoff", "battery_landing", "session_incidents"})
+	for _, le := range entries {
+		for _, f := range le.Flights {
+			landing, secs := "", ""
+			if !f.Landing.IsZero() {
+				landing = f.Landing.Format(time.RFC3339)
+				secs = strconv.Itoa(int(f.Landing.Sub(f.TakeOff).Seconds()))
+			}
+			w.Write([]string{le.Start.Format(time.RFC3339), le.SSID, le.Version, le.Battery, f.TakeOff.Format(time.RFC3339),
+				landing, secs, strconv.Itoa(int(f.BatteryTakeOff)), strconv.Itoa(int(f.BatteryLanding)),
+				incidentSummary(le.Incidents)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
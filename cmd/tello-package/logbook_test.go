@@ -0,0 +1,56 @@
+// logbook_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogbookFilterMatch(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2018, time.June, d, 12, 0, 0, 0, time.UTC) }
+	flown := &logEntry{Start: day(10), SSID: "TELLO-ABC123", Flights: []flightRecord{{TakeOff: day(10)}}}
+	idle := &logEntry{Start: day(12), SSID: "TELLO-DEF456"}
+	crashed := &logEntry{Start: day(14), SSID: "TELLO-ABC123", Flights: []flightRecord{{TakeOff: day(14)}},
+		Incidents: []sessionWarning{{Time: day(14), Msg: "crash"}}}
+
+	tests := []struct {
+		name string
+		lf   logbookFilter
+		want []bool // flown, idle, crashed
+	}{
+		{"no filter", logbookFilter{}, []bool{true, true, true}},
+		{"drone", logbookFilter{drone: "tello-abc123"}, []bool{true, false, true}},
+		{"since", logbookFilter{since: day(12)}, []bool{false, true, true}},
+		{"until is exclusive", logbookFilter{until: day(12)}, []bool{true, false, false}},
+		{"flown", logbookFilter{flownOnly: true}, []bool{true, false, true}},
+		{"incidents", logbookFilter{incidentOnly: true}, []bool{false, false, true}},
+		{"combined", logbookFilter{drone: "TELLO-ABC123", since: day(11), flownOnly: true}, []bool{false, false, true}},
+	}
+	for _, tc := range tests {
+		for i, le := range []*logEntry{flown, idle, crashed} {
+			if got := tc.lf.match(le); got != tc.want[i] {
+				t.Errorf("%s: entry %d match = %v, want %v", tc.name, i, got, tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// macro.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// A macro is a recording of stick movements and commands, from any source, with their timing.
+// It is saved to a file when recording stops so that it can be played back, then or later, to
+// repeat a manoeuvre exactly.  A hover command (the panic key) aborts playback at once.
+
+const macroSrc = "macro"
+
+type macroStep struct {
+	At      time.Duration
+	Sticks  *tello.StickMessage `json:",omitempty"`
+	Command string              `json:",omitempty"`
+}
+
+var (
+	macroMu        sync.Mutex
+	macroRecording bool
+	macroStart     time.Time
+	macroSteps     []macroStep
+	macroAbort     chan struct{} // non-nil during playback
+)
+
+// recordMacroSticks adds stick movements to the macro being recorded,
+// they are recorded before any beginner limits so that those are applied on playback
+func recordMacroSticks(sm tello.StickMessage) {
+	macroMu.Lock()
+	defer macroMu.Unlock()
+	if macroRecording {
+		macroSteps = append(macroSteps, macroStep{At: time.Since(macroStart), Sticks: &sm})
+	}
+}
+
+// recordMacroCommand adds a command to the macro being recorded, a hover also aborts playback
+func recordMacroCommand(source, command string) {
+	if source == macroSrc {
+		return
+	}
+	if command == "hover" {
+		abortMacro()
+	}
+	if !knownCommand(command) {
+		return
+	}
+	macroMu.Lock()
+	defer macroMu.Unlock()
+	if macroRecording {
+		macroSteps = append(macroSteps, macroStep{At: time.Since(macroStart), Command: command})
+	}
+}
+
+// toggleMacroRecording starts a new recording, or stops it and saves it in the file
+func toggleMacroRecording(filename string) {
+	macroMu.Lock()
+	playing, recording := macroAbort != nil, macroRecording
+	steps, took := macroSteps, time.Since(macroStart)
+	if !playing {
+		macroRecording = !recording
+		if macroRecording {
+			macroStart, macroSteps = time.Now(), nil
+		}
+	}
+	macroMu.Unlock()
+
+	switch {
+	case playing:
+		setFlightMsg("Cannot record during macro playback")
+		return
+	case !recording:
+		log.Println("Macro recording started")
+		setFlightMsg("Recording macro")
+		return
+	}
+	log.Printf("Macro recording stopped, %d steps in %s\n", len(steps), took.Round(time.Millisecond))
+	data, err := json.MarshalIndent(steps, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filename, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Error saving macro to %s - %v\n", filename, err)
+		setFlightMsg("Macro not saved")
+		return
+	}
+	setFlightMsg("Macro saved")
+}
+
+func macroRecordingNow() bool {
+	macroMu.Lock()
+	defer macroMu.Unlock()
+	return macroRecording
+}
+
+// playMacro loads the macro from the file and plays it in the background
+func playMacro(filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Printf("Unable to load macro - %v\n", err)
+		setFlightMsg("No macro to play")
+		return
+	}
+	var steps []macroStep
+	if err = json.Unmarshal(data, &steps); err != nil {
+		log.Printf("Bad macro in %s - %v\n", filename, err)
+		setFlightMsg("Bad macro")
+		return
+	}
+	macroMu.Lock()
+	if macroRecording || macroAbort != nil {
+		macroMu.Unlock()
+		setFlightMsg("Macro already recording or playing")
+		return
+	}
+	abort := make(chan struct{})
+	macroAbort = abort
+	macroMu.Unlock()
+
+	log.Printf("Playing macro %s, %d steps\n", filename, len(steps))
+	setFlightMsg("Playing macro - SPACE to abort")
+	go func() {
+		defer blackBoxOnPanic()
+		start := time.Now()
+		for _, step := range steps {
+			select {
+			case <-abort:
+				updateSticks(tello.StickMessage{})
+				log.Println("Macro playback aborted")
+				setFlightMsg("Macro aborted")
+				return
+			case <-time.After(time.Until(start.Add(step.At))):
+			}
+			if step.Sticks != nil {
+				updateSticks(*step.Sticks)
+			} else {
+				runCommand(macroSrc, step.Command)
+			}
+		}
+		macroMu.Lock()
+		if macroAbort == abort {
+			macroAbort = nil
+		}
+		macroMu.Unlock()
+		updateSticks(tello.StickMessage{})
+		log.Println("Macro playback finished")
+		setFlightMsg("Macro finished")
+	}()
+}
+
+// abortMacro stops playback, if there is any
+func abortMacro() {
+	macroMu.Lock()
+	defer macroMu.Unlock()
+	if macroAbort != nil {
+		close(macroAbort)
+		macroAbort = nil
+	}
+}
@@ -0,0 +1,405 @@
+// mavlink.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// A minimal MAVLink v1 bridge so that ground control stations such as QGroundControl can see and
+// fly the Tello.  Only the handful of messages we need are implemented here.
+
+const (
+	mavStx           = 0xFE
+	mavHeaderLen     = 6
+	mavCRCLen        = 2
+	mavSysID         = 1
+	mavCompID        = 1 // MAV_COMP_ID_AUTOPILOT1
+	mavHeartbeatRate = time.Second
+	mavTelemetryRate = 100 * time.Millisecond
+	mavMaxPacket     = 263
+	mavManualTimeout = 500 * time.Millisecond // centre the sticks if the GCS stops sending them
+)
+
+// MAVLink message IDs
+const (
+	mavMsgHeartbeat        = 0
+	mavMsgSysStatus        = 1
+	mavMsgAttitude         = 30
+	mavMsgLocalPositionNED = 32
+	mavMsgManualControl    = 69
+	mavMsgVfrHud           = 74
+	mavMsgCommandLong      = 76
+	mavMsgCommandAck       = 77
+)
+
+// the CRC_EXTRA seed byte for each message we understand
+var mavCRCExtra = map[uint8]uint8{
+	mavMsgHeartbeat:        50,
+	mavMsgSysStatus:        124,
+	mavMsgAttitude:         39,
+	mavMsgLocalPositionNED: 185,
+	mavMsgManualControl:    243,
+	mavMsgVfrHud:           20,
+	mavMsgCommandLong:      152,
+	mavMsgCommandAck:       143,
+}
+
+// MAVLink enumeration values that we use
+const (
+	mavTypeQuadrotor       = 2
+	mavAutopilotGeneric    = 0
+	mavModeFlagCustomMode  = 1
+	mavModeFlagManualInput = 64
+	mavModeFlagSafetyArmed = 128
+	mavStateStandby        = 3
+	mavStateActive         = 4
+	mavVersion             = 3
+	mavCmdNavLand          = 21
+	mavCmdNavTakeoff       = 22
+	mavResultAccepted      = 0
+	mavResultUnsupported   = 3
+)
+
+// Message payloads, the fields are in MAVLink wire order (largest type first)
+type mavHeartbeat struct {
+	CustomMode                                              uint32
+	Type, Autopilot, BaseMode, SystemStatus, MavlinkVersion uint8
+}
+
+type mavSysStatus struct {
+	SensorsPresent, SensorsEnabled, SensorsHealth uint32
+	Load, VoltageBattery                          uint16
+	CurrentBattery                                int16
+	DropRateComm, ErrorsComm                      uint16
+	ErrorsCount                                   [4]uint16
+	BatteryRemaining                              int8
+}
+
+type mavAttitude struct {
+	TimeBootMs                      uint32
+	Roll, Pitch, Yaw                float32
+	RollSpeed, PitchSpeed, YawSpeed float32
+}
+
+type mavLocalPositionNED struct {
+	TimeBootMs uint32
+	X, Y, Z    float32
+	Vx, Vy, Vz float32
+}
+
+type mavVfrHud struct {
+	Airspeed, Groundspeed, Alt, Climb float32
+	Heading                           int16
+	Throttle                          uint16
+}
+
+type mavCommandLong struct {
+	Param                                       [7]float32
+	Command                                     uint16
+	TargetSystem, TargetComponent, Confirmation uint8
+}
+
+type mavCommandAck struct {
+	Command uint16
+	Result  uint8
+}
+
+type mavManualControl struct {
+	X, Y, Z, R int16
+	Buttons    uint16
+	Target     uint8
+}
+
+var (
+	mavConn    *net.UDPConn
+	mavGCSAddr *net.UDPAddr
+	mavSeq     uint8
+	mavMu      sync.Mutex // protects mavGCSAddr, mavSeq & the manual control state
+	mavBooted  = time.Now()
+
+	mavManualAt   time.Time // when the last MANUAL_CONTROL arrived
+	mavManualLive bool      // the GCS is flying with MANUAL_CONTROL
+)
+
+func startMAVLink(gcs string) error {
+	var err error
+	if mavGCSAddr, err = net.ResolveUDPAddr("udp", gcs); err != nil {
+		return err
+	}
+	if mavConn, err = net.ListenUDP("udp", nil); err != nil {
+		return err
+	}
+	log.Printf("Sending MAVLink to %s from %s\n", mavGCSAddr, mavConn.LocalAddr())
+	go mavSender()
+	go mavReceiver()
+	return nil
+}
+
+// mavCRC is the X.25 CRC used by MAVLink
+func mavCRC(buf []byte, extra uint8) uint16 {
+	crc := uint16(0xFFFF)
+	acc := func(b uint8) {
+		tmp := b ^ uint8(crc&0xFF)
+		tmp ^= tmp << 4
+		crc = (crc >> 8) ^ (uint16(tmp) << 8) ^ (uint16(tmp) << 3) ^ (uint16(tmp) >> 4)
+	}
+	for _, b := range buf {
+		acc(b)
+	}
+	acc(extra)
+	return crc
+}
+
+// mavSend frames and sends a single message to the GCS
+func mavSend(msgID uint8, payload interface{}) {
+	mavMu.Lock()
+	defer mavMu.Unlock()
+	var pl bytes.Buffer
+	binary.Write(&pl, binary.LittleEndian, payload)
+	pkt := mavEncode(mavSeq, msgID, pl.Bytes())
+	mavSeq++
+	if _, err := mavConn.WriteToUDP(pkt, mavGCSAddr); err != nil {
+		log.Printf("Error sending MAVLink message %v\n", err)
+	}
+}
+
+// mavEncode frames one v1 message from us
+func mavEncode(seq, msgID uint8, payload []byte) []byte {
+	pkt := make([]byte, 0, mavHeaderLen+len(payload)+mavCRCLen)
+	pkt = append(pkt, mavStx, uint8(len(payload)), seq, mavSysID, mavCompID, msgID)
+	pkt = append(pkt, payload...)
+	crc := mavCRC(pkt[1:], mavCRCExtra[msgID])
+	return append(pkt, uint8(crc), uint8(crc>>8))
+}
+
+func mavSender() {
+	defer blackBoxOnPanic()
+	telemTick := time.NewTicker(mavTelemetryRate)
+	hbTick := time.NewTicker(mavHeartbeatRate)
+	for {
+		select {
+		case <-hbTick.C:
+			flightDataMu.RLock()
+			hb := mavMakeHeartbeat(flightData)
+			flightDataMu.RUnlock()
+			mavSend(mavMsgHeartbeat, hb)
+		case <-telemTick.C:
+			flightDataMu.RLock()
+			fd := flightData
+			flightDataMu.RUnlock()
+			mavSendTelemetry(fd)
+			if mavManualExpired(time.Now()) {
+				log.Println("MAVLink manual control stopped, centring sticks")
+				remoteSticks(tello.StickMessage{})
+			}
+		}
+	}
+}
+
+func mavMakeHeartbeat(fd tello.FlightData) mavHeartbeat {
+	hb := mavHeartbeat{
+		Type:           mavTypeQuadrotor,
+		Autopilot:      mavAutopilotGeneric,
+		BaseMode:       mavModeFlagCustomMode | mavModeFlagManualInput,
+		CustomMode:     uint32(fd.FlyMode),
+		SystemStatus:   mavStateStandby,
+		MavlinkVersion: mavVersion,
+	}
+	if fd.Flying {
+		hb.BaseMode |= mavModeFlagSafetyArmed
+		hb.SystemStatus = mavStateActive
+	}
+	return hb
+}
+
+func mavSendTelemetry(fd tello.FlightData) {
+	bootMs := uint32(time.Since(mavBooted) / time.Millisecond)
+	pitch, roll, yaw := tello.QuatToEulerDeg(fd.IMU.QuaternionX, fd.IMU.QuaternionY, fd.IMU.QuaternionZ, fd.IMU.QuaternionW)
+	north := float32(speedMS(fd.NorthSpeed))
+	east := float32(speedMS(fd.EastSpeed))
+	climb := float32(speedMS(fd.VerticalSpeed))
+	height := float32(fd.Height) / 10
+
+	mavSend(mavMsgSysStatus, mavSysStatus{
+		VoltageBattery:   uint16(fd.BatteryMilliVolts),
+		CurrentBattery:   -1, // not measured
+		BatteryRemaining: fd.BatteryPercentage,
+	})
+	mavSend(mavMsgAttitude, mavAttitude{
+		TimeBootMs: bootMs,
+		Roll:       degToRad(roll),
+		Pitch:      degToRad(pitch),
+		Yaw:        degToRad(yaw),
+	})
+	mavSend(mavMsgVfrHud, mavVfrHud{
+		Groundspeed: float32(math.Hypot(float64(north), float64(east))),
+		Alt:         height,
+		Climb:       climb,
+		Heading:     int16((yaw + 360) % 360),
+	})
+	mavSend(mavMsgLocalPositionNED, mavLocalPositionNED{
+		TimeBootMs: bootMs,
+		X:          fd.MVO.PositionX,
+		Y:          fd.MVO.PositionY,
+		Z:          -height,
+		Vx:         north,
+		Vy:         east,
+		Vz:         -climb,
+	})
+}
+
+func degToRad(deg int) float32 {
+	return float32(float64(deg) * math.Pi / 180)
+}
+
+func mavReceiver() {
+	defer blackBoxOnPanic()
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := mavConn.ReadFromUDP(buf)
+		if err != nil {
+			log.Printf("Error reading MAVLink %v\n", err)
+			return
+		}
+		frames := mavParse(buf[:n])
+		if len(frames) == 0 {
+			continue
+		}
+		// reply to wherever the GCS is actually talking from, but only once it has sent real MAVLink
+		mavMu.Lock()
+		mavGCSAddr = from
+		mavMu.Unlock()
+		for _, f := range frames {
+			mavHandle(f.msgID, f.payload)
+		}
+	}
+}
+
+// mavFrame is one received message, the payload refers to the datagram it came in
+type mavFrame struct {
+	msgID   uint8
+	payload []byte
+}
+
+// mavParse returns all the v1 messages in one datagram with a valid checksum, anything else is ignored
+func mavParse(pkt []byte) (frames []mavFrame) {
+	for len(pkt) >= mavHeaderLen+mavCRCLen {
+		if pkt[0] != mavStx {
+			pkt = pkt[1:]
+			continue
+		}
+		plLen := int(pkt[1])
+		frameLen := mavHeaderLen + plLen + mavCRCLen
+		if len(pkt) < frameLen {
+			return frames
+		}
+		msgID := pkt[5]
+		payload := pkt[mavHeaderLen : mavHeaderLen+plLen]
+		extra, known := mavCRCExtra[msgID]
+		crc := binary.LittleEndian.Uint16(pkt[mavHeaderLen+plLen:])
+		if known && crc == mavCRC(pkt[1:mavHeaderLen+plLen], extra) {
+			frames = append(frames, mavFrame{msgID: msgID, payload: payload})
+		}
+		pkt = pkt[frameLen:]
+	}
+	return frames
+}
+
+func mavHandle(msgID uint8, payload []byte) {
+	switch msgID {
+	case mavMsgCommandLong:
+		var cmd mavCommandLong
+		if binary.Read(bytes.NewReader(payload), binary.LittleEndian, &cmd) != nil {
+			return
+		}
+		if cmd.TargetSystem != mavSysID && cmd.TargetSystem != 0 {
+			return
+		}
+		result := uint8(mavResultAccepted)
+		switch cmd.Command {
+		case mavCmdNavTakeoff:
+			log.Println("MAVLink takeoff command")
+			drone.TakeOff()
+			commandIssued(mavlinkSrc, "takeoff")
+		case mavCmdNavLand:
+			log.Println("MAVLink land command")
+			drone.Land()
+			commandIssued(mavlinkSrc, "land")
+		default:
+			result = mavResultUnsupported
+		}
+		mavSend(mavMsgCommandAck, mavCommandAck{Command: cmd.Command, Result: result})
+	case mavMsgManualControl:
+		var mc mavManualControl
+		if binary.Read(bytes.NewReader(payload), binary.LittleEndian, &mc) != nil {
+			return
+		}
+		if mc.Target != mavSysID && mc.Target != 0 {
+			return
+		}
+		mavManualReceived(time.Now())
+		// x, y & r are -1000..1000 while z (throttle) is 0..1000 with 500 as the centre
+		remoteSticks(tello.StickMessage{
+			Ry: mavScaleStick(int(mc.X)),
+			Rx: mavScaleStick(int(mc.Y)),
+			Ly: mavScaleStick((int(mc.Z) - 500) * 2),
+			Lx: mavScaleStick(int(mc.R)),
+		})
+	}
+}
+
+// mavManualReceived notes that the GCS is flying the drone
+func mavManualReceived(now time.Time) {
+	mavMu.Lock()
+	mavManualAt, mavManualLive = now, true
+	mavMu.Unlock()
+}
+
+// mavManualExpired reports, once, that MANUAL_CONTROL has stopped arriving
+func mavManualExpired(now time.Time) bool {
+	mavMu.Lock()
+	defer mavMu.Unlock()
+	if mavManualLive && now.Sub(mavManualAt) > mavManualTimeout {
+		mavManualLive = false
+		return true
+	}
+	return false
+}
+
+func mavScaleStick(v int) int16 {
+	if v > 1000 {
+		v = 1000
+	}
+	if v < -1000 {
+		v = -1000
+	}
+	return int16(v * math.MaxInt16 / 1000)
+}
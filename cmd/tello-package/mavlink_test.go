@@ -0,0 +1,118 @@
+// mavlink_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMavCRC(t *testing.T) {
+	// MAVLink's checksum is CRC-16/MCRF4XX, whose standard check value is for "123456789",
+	// here the last byte is passed as the CRC_EXTRA
+	if crc := mavCRC([]byte("12345678"), '9'); crc != 0x6F91 {
+		t.Errorf("mavCRC check value = %#04x, want 0x6f91", crc)
+	}
+}
+
+func TestMavEncode(t *testing.T) {
+	payload := []byte{0, 0, 0, 0, mavTypeQuadrotor, mavAutopilotGeneric, 0, mavStateStandby, mavVersion}
+	pkt := mavEncode(7, mavMsgHeartbeat, payload)
+	if len(pkt) != mavHeaderLen+len(payload)+mavCRCLen {
+		t.Fatalf("frame length = %d, want %d", len(pkt), mavHeaderLen+len(payload)+mavCRCLen)
+	}
+	if want := []byte{mavStx, uint8(len(payload)), 7, mavSysID, mavCompID, mavMsgHeartbeat}; !bytes.Equal(pkt[:mavHeaderLen], want) {
+		t.Errorf("header = %v, want %v", pkt[:mavHeaderLen], want)
+	}
+	if !bytes.Equal(pkt[mavHeaderLen:mavHeaderLen+len(payload)], payload) {
+		t.Errorf("payload = %v, want %v", pkt[mavHeaderLen:mavHeaderLen+len(payload)], payload)
+	}
+	crc := mavCRC(pkt[1:mavHeaderLen+len(payload)], mavCRCExtra[mavMsgHeartbeat])
+	if got := uint16(pkt[len(pkt)-2]) | uint16(pkt[len(pkt)-1])<<8; got != crc {
+		t.Errorf("checksum = %#04x, want %#04x", got, crc)
+	}
+}
+
+func TestMavParse(t *testing.T) {
+	hb := mavEncode(7, mavMsgHeartbeat, []byte{0, 0, 0, 0, mavTypeQuadrotor, mavAutopilotGeneric, 0, mavStateStandby, mavVersion})
+	ack := mavEncode(8, mavMsgCommandAck, []byte{mavCmdNavLand, 0, 0})
+	badCRC := append([]byte(nil), hb...)
+	badCRC[len(badCRC)-1] ^= 0xFF
+	wrongExtra := append([]byte(nil), ack...)
+	wrongExtra[5] = mavMsgHeartbeat // the checksum was made with the COMMAND_ACK CRC_EXTRA
+	unknown := append([]byte(nil), hb...)
+	unknown[5] = 200
+
+	tests := []struct {
+		name string
+		pkt  []byte
+		want []uint8 // message IDs
+	}{
+		{"heartbeat", hb, []uint8{mavMsgHeartbeat}},
+		{"two in one datagram", append(append([]byte(nil), hb...), ack...), []uint8{mavMsgHeartbeat, mavMsgCommandAck}},
+		{"garbage before", append([]byte{0x00, 0x42, 0x13}, ack...), []uint8{mavMsgCommandAck}},
+		{"bad checksum", badCRC, nil},
+		{"wrong CRC_EXTRA", wrongExtra, nil},
+		{"unknown message", unknown, nil},
+		{"truncated", hb[:len(hb)-1], nil},
+		{"bad then good", append(append([]byte(nil), badCRC...), ack...), []uint8{mavMsgCommandAck}},
+	}
+	for _, tc := range tests {
+		frames := mavParse(tc.pkt)
+		if len(frames) != len(tc.want) {
+			t.Errorf("%s: got %d frames, want %d", tc.name, len(frames), len(tc.want))
+			continue
+		}
+		for i, f := range frames {
+			if f.msgID != tc.want[i] {
+				t.Errorf("%s: frame %d is message %d, want %d", tc.name, i, f.msgID, tc.want[i])
+			}
+		}
+	}
+
+	frames := mavParse(ack)
+	if len(frames) == 1 && !bytes.Equal(frames[0].payload, []byte{mavCmdNavLand, 0, 0}) {
+		t.Errorf("payload = %v, want %v", frames[0].payload, []byte{mavCmdNavLand, 0, 0})
+	}
+}
+
+func TestMavManualTimeout(t *testing.T) {
+	start := time.Now()
+	if mavManualExpired(start.Add(time.Hour)) {
+		t.Error("expired before any MANUAL_CONTROL arrived")
+	}
+	mavManualReceived(start)
+	if mavManualExpired(start.Add(mavManualTimeout / 2)) {
+		t.Error("expired while MANUAL_CONTROL is still arriving")
+	}
+	if !mavManualExpired(start.Add(mavManualTimeout + time.Millisecond)) {
+		t.Error("not expired after MANUAL_CONTROL stopped")
+	}
+	if mavManualExpired(start.Add(2 * mavManualTimeout)) {
+		t.Error("expired twice for one loss of MANUAL_CONTROL")
+	}
+	mavManualReceived(start.Add(3 * mavManualTimeout))
+	if !mavManualExpired(start.Add(5 * mavManualTimeout)) {
+		t.Error("not expired after MANUAL_CONTROL resumed and stopped again")
+	}
+}
@@ -0,0 +1,280 @@
+// menu.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nosdl
+// +build !nosdl
+
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// The on-screen menu makes every action and setting reachable from the game controller.
+// The menu button opens and closes it, the D-pad moves up and down and changes settings
+// with left and right, and X selects.  The sticks keep flying the drone while it is open,
+// and Circle still hovers.
+
+const (
+	menuX, menuY      = 810, 40
+	menuW             = 380
+	menuLineHeight    = 28
+	menuTitle         = "Menu"
+	menuOpenFlightMsg = "Menu: D-pad to choose, X to select"
+)
+
+type menuItem struct {
+	label    func() string
+	activate func()
+	change   func(dir int) // for settings, nil for actions
+	closes   bool          // the menu is closed after activation
+}
+
+var (
+	menuMu     sync.Mutex
+	menuIsOpen bool
+	menuSel    int
+	menuMsg    string
+)
+
+// menuAction is a drone command from the menu
+func menuAction(label, command string) menuItem {
+	return menuItem{
+		label:    func() string { return label },
+		activate: func() { runCommand(joystickSrc, command) },
+		closes:   true,
+	}
+}
+
+var menuItems = []menuItem{
+	menuAction("Take Off", "takeoff"),
+	menuAction("Throw Take Off", "throw_takeoff"),
+	menuAction("Land", "land"),
+	menuAction("Palm Land", "palm_land"),
+	menuAction("Bounce", "bounce"),
+	menuAction("Flip Forward", "flip_forward"),
+	menuAction("Flip Back", "flip_backward"),
+	menuAction("Flip Left", "flip_left"),
+	menuAction("Flip Right", "flip_right"),
+	menuAction("Take Photo", "photo"),
+	{
+		label:    func() string { return "Sports Mode: " + onOff(sportsMode) },
+		activate: menuSportsMode,
+		change:   func(dir int) { menuSportsMode() },
+	},
+	{
+		label:    func() string { return "Video Mode: " + videoModeName(wideVideo) },
+		activate: func() { setVideoMode(!wideVideo) },
+		change:   func(dir int) { setVideoMode(!wideVideo) },
+	},
+	{
+		label: func() string { return "Bitrate: " + bitrateChoiceName(bitrateChoice()) },
+		activate: func() {
+			setBitrateChoice((bitrateChoice() + 1) % (len(vbrLevels) + 1))
+		},
+		change: func(dir int) {
+			setBitrateChoice(clampInt(bitrateChoice()+dir, 0, len(vbrLevels)))
+		},
+	},
+	{
+		label:    func() string { return "Recording: " + onOff(recordingVideo()) },
+		activate: toggleRecording,
+		change:   func(dir int) { toggleRecording() },
+	},
+	{
+		label:    func() string { return "Macro Recording: " + onOff(macroRecordingNow()) },
+		activate: func() { toggleMacroRecording(*macroFlag) },
+	},
+	{
+		label:    func() string { return "Play Macro" },
+		activate: func() { playMacro(*macroFlag) },
+		closes:   true,
+	},
+	{
+		label:    func() string { return "Drone Settings..." },
+		activate: toggleSettings,
+		closes:   true,
+	},
+	{
+		label:  func() string { return "Close Menu" },
+		closes: true,
+	},
+	{
+		label: func() string { return "Quit" },
+		activate: func() {
+			flightDataMu.RLock()
+			flying := flightData.Flying
+			flightDataMu.RUnlock()
+			if flying {
+				menuMu.Lock()
+				menuMsg = "Land before quitting"
+				menuMu.Unlock()
+				return
+			}
+			exitNicely()
+		},
+	},
+}
+
+func onOff(b bool) string {
+	if b {
+		return "On"
+	}
+	return "Off"
+}
+
+func menuSportsMode() {
+	commandIssued(joystickSrc, "sports_mode")
+	toggleSportsMode()
+}
+
+func menuOpen() bool {
+	menuMu.Lock()
+	defer menuMu.Unlock()
+	return menuIsOpen
+}
+
+func toggleMenu() {
+	menuMu.Lock()
+	defer menuMu.Unlock()
+	menuIsOpen, menuMsg = !menuIsOpen, ""
+	if menuIsOpen {
+		setFlightMsg(menuOpenFlightMsg)
+	}
+}
+
+// menuHat moves around the menu with the D-pad
+func menuHat(value uint8) {
+	menuMu.Lock()
+	defer menuMu.Unlock()
+	menuMsg = ""
+	switch value {
+	case sdl.HAT_UP:
+		menuSel = (menuSel + len(menuItems) - 1) % len(menuItems)
+	case sdl.HAT_DOWN:
+		menuSel = (menuSel + 1) % len(menuItems)
+	case sdl.HAT_LEFT, sdl.HAT_RIGHT:
+		if change := menuItems[menuSel].change; change != nil {
+			dir := 1
+			if value == sdl.HAT_LEFT {
+				dir = -1
+			}
+			change(dir)
+		}
+	}
+}
+
+// menuSelect activates the selected item
+func menuSelect() {
+	menuMu.Lock()
+	item := menuItems[menuSel]
+	menuMsg = ""
+	if item.closes {
+		menuIsOpen = false
+	}
+	// actions may open other panels, so do not hold the lock
+	menuMu.Unlock()
+	if item.activate != nil {
+		log.Printf("Menu: %s\n", item.label())
+		item.activate()
+	}
+}
+
+// handleJoyHatEvent sends the D-pad to the settings panel or the menu, whichever is open
+func handleJoyHatEvent(ev *sdl.JoyHatEvent) {
+	if ev.Value == sdl.HAT_CENTERED {
+		return
+	}
+	if settingsOpen() {
+		switch ev.Value {
+		case sdl.HAT_UP:
+			settingsKeyDown(keyUp)
+		case sdl.HAT_DOWN:
+			settingsKeyDown(keyDown)
+		case sdl.HAT_LEFT:
+			settingsKeyDown(keyLeft)
+		case sdl.HAT_RIGHT:
+			settingsKeyDown(keyRight)
+		}
+		return
+	}
+	if menuOpen() {
+		menuHat(ev.Value)
+	}
+}
+
+// menuButtonEvent handles a controller button while the menu or settings panel is open,
+// it returns false if the button should have its usual effect
+func menuButtonEvent(button uint8) bool {
+	switch {
+	case settingsOpen():
+		switch button {
+		case menuButton:
+			settingsKeyDown(keyEscape)
+		case landButton:
+			settingsPadAccept()
+		case stopButton:
+			return false
+		}
+		return true
+	case button == menuButton:
+		toggleMenu()
+		return true
+	case menuOpen():
+		switch button {
+		case landButton:
+			menuSelect()
+		case stopButton:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// drawMenu draws the menu over the charts
+func drawMenu() {
+	if !menuOpen() {
+		return
+	}
+	menuMu.Lock()
+	defer menuMu.Unlock()
+	h := int32((len(menuItems) + 3) * menuLineHeight)
+	setDrawColour(bgColour)
+	renderer.FillRect(&sdl.Rect{X: menuX, Y: menuY, W: menuW, H: h})
+	setDrawColour(hudColour)
+	renderer.DrawRect(&sdl.Rect{X: menuX, Y: menuY, W: menuW, H: h})
+	renderTextAt(menuTitle, medFont, menuX+10, menuY+4)
+	for i, item := range menuItems {
+		y := int32(menuY + (i+1)*menuLineHeight + 4)
+		if i == menuSel {
+			setDrawColour(hudColour)
+			renderer.DrawRect(&sdl.Rect{X: menuX + 4, Y: y, W: menuW - 8, H: menuLineHeight})
+		}
+		renderTextAt(item.label(), medFont, menuX+10, y)
+	}
+	if menuMsg != "" {
+		renderTextAt(menuMsg, medFont, menuX+10, int32(menuY+(len(menuItems)+1)*menuLineHeight+8))
+	}
+}
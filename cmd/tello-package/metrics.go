@@ -0,0 +1,158 @@
+// metrics.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/SMerrony/tello"
+)
+
+const (
+	droneNamespace = "tello"
+	appNamespace   = "tello_desktop"
+	metricsPath    = "/metrics"
+)
+
+// command sources for the commands metric
+const (
+	keyboardSrc = "keyboard"
+	joystickSrc = "joystick"
+	mqttSrc     = "mqtt"
+	mavlinkSrc  = "mavlink"
+	grpcSrc     = "grpc"
+	beginnerSrc = "beginner" // automatic landing at the end of a beginner's flight
+)
+
+// app-internal metrics, these are always counted but only served if -metrics is given
+var (
+	videoBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "video_bytes_total",
+		Help: "Bytes of H.264 video received from the drone."})
+	videoFrames = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "video_frames_total",
+		Help: "Complete video frames (access units) received from the drone."})
+	playerWriteErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "player_write_errors_total",
+		Help: "Failed writes of video to mplayer."})
+	flightDataPackets = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "flight_data_packets_total",
+		Help: "Flight data updates received, use rate() for packets per second."})
+	videoDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "video_dropped_total",
+		Help: "Video frames not passed to a consumer because it fell behind."}, []string{"consumer"})
+	keyframeRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "keyframe_requests_total",
+		Help: "Requests to the drone for a video keyframe."})
+	commands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: appNamespace, Name: "commands_total",
+		Help: "Commands sent to the drone by source and command."}, []string{"source", "command"})
+)
+
+// names of the keyboard and joystick controls for the commands metric
+var (
+	keyCommandNames = map[keyCode]string{
+		bounceKey:    "bounce",
+		flipFwdKey:   "flip_forward",
+		flipBkwdKey:  "flip_backward",
+		flipLeftKey:  "flip_left",
+		flipRightKey: "flip_right",
+		landKey:      "land",
+		modeKey:      "sports_mode",
+		moveBkKey:    "backward",
+		moveDownKey:  "down",
+		moveFwdKey:   "forward",
+		moveLeftKey:  "left",
+		moveRightKey: "right",
+		moveUpKey:    "up",
+		palmlandKey:  "palm_land",
+		panicKey:     "hover",
+		takeOffKey:   "takeoff",
+		takePhotoKey: "photo",
+		throwKey:     "throw_takeoff",
+		turnLeftKey:  "turn_left",
+		turnRightKey: "turn_right",
+		videoModeKey: "video_mode",
+		macroRecKey:  "macro_record",
+		macroPlayKey: "macro_play",
+	}
+	buttonCommandNames = map[uint8]string{
+		bounceButton:    "bounce",
+		landButton:      "land",
+		palmLandButton:  "palm_land",
+		stopButton:      "hover",
+		takeOffButton:   "takeoff",
+		takePhotoButton: "photo",
+	}
+)
+
+func countCommand(source, command string) {
+	commands.WithLabelValues(source, command).Inc()
+}
+
+// flightGauge makes a gauge which reads the latest flight data whenever it is scraped
+func flightGauge(name, help string, get func(fd *tello.FlightData) float64) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: droneNamespace, Name: name, Help: help},
+		func() float64 {
+			flightDataMu.RLock()
+			defer flightDataMu.RUnlock()
+			return get(&flightData)
+		})
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func startMetrics(addr string) {
+	prometheus.MustRegister(videoBytes, videoFrames, playerWriteErrors, flightDataPackets, videoDropped, keyframeRequests, commands)
+	prometheus.MustRegister(
+		flightGauge("battery_percent", "Battery charge remaining.",
+			func(fd *tello.FlightData) float64 { return float64(fd.BatteryPercentage) }),
+		flightGauge("height_metres", "Height above the takeoff point.",
+			func(fd *tello.FlightData) float64 { return float64(fd.Height) / 10 }),
+		flightGauge("wifi_strength", "WiFi signal strength reported by the drone.",
+			func(fd *tello.FlightData) float64 { return float64(fd.WifiStrength) }),
+		flightGauge("wifi_interference", "WiFi interference reported by the drone.",
+			func(fd *tello.FlightData) float64 { return float64(fd.WifiInterference) }),
+		flightGauge("flight_time_left_seconds", "Estimated flight time remaining.",
+			func(fd *tello.FlightData) float64 { return float64(fd.DroneFlyTimeLeft) }),
+		flightGauge("over_temperature", "1 if the drone is over temperature.",
+			func(fd *tello.FlightData) float64 { return boolToFloat(fd.OverTemp) }),
+		flightGauge("flying", "1 if the drone is flying.",
+			func(fd *tello.FlightData) float64 { return boolToFloat(fd.Flying) }),
+	)
+	http.Handle(metricsPath, promhttp.Handler())
+	go func() {
+		log.Printf("Serving metrics on %s%s\n", addr, metricsPath)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("Metrics server stopped - %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,239 @@
+// mjpeg.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The MJPEG preview decodes the video with an external ffmpeg, in the same way that we use mplayer
+// for display, and serves the resulting JPEGs to browsers as a multipart stream.
+
+const (
+	mjpegBoundary  = "tellomjpegframe"
+	mjpegPath      = "/mjpeg"
+	mjpegQuality   = "5" // ffmpeg -q:v, 2 (best) to 31 (worst)
+	mjpegReadBuf   = 64 * 1024
+	overlayFontCol = "yellow"
+)
+
+var (
+	jpegSOI = []byte{0xFF, 0xD8}
+	jpegEOI = []byte{0xFF, 0xD9}
+)
+
+// mjpegFrames holds the latest decoded frame for all the HTTP clients
+var mjpegFrames = struct {
+	sync.Mutex
+	cond  *sync.Cond
+	frame []byte
+	seq   uint64
+	done  bool // the decoder has stopped, there will be no more frames
+}{}
+
+func startMJPEG(addr string) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg is required for the MJPEG stream - %v", err)
+	}
+	mjpegFrames.cond = sync.NewCond(&mjpegFrames)
+
+	vf := fmt.Sprintf("fps=%d,scale=%d:-2", *mjpegFPSFlag, *mjpegWidthFlag)
+	if *mjpegOverlayFlag {
+		overlay := filepath.Join(os.TempDir(), fmt.Sprintf("tello-overlay-%d.txt", os.Getpid()))
+		writeOverlay(overlay)
+		go func() {
+			defer blackBoxOnPanic()
+			for {
+				time.Sleep(winUpdatePeriod)
+				writeOverlay(overlay)
+			}
+		}()
+		vf += fmt.Sprintf(",drawtext=textfile=%s:reload=1:x=8:y=8:fontcolor=%s:box=1:boxcolor=black@0.5",
+			overlay, overlayFontCol)
+	}
+	decoder := exec.Command("ffmpeg", "-loglevel", "error", "-f", "h264", "-i", "-",
+		"-vf", vf, "-f", "image2pipe", "-vcodec", "mjpeg", "-q:v", mjpegQuality, "-")
+	decoderIn, err := decoder.StdinPipe()
+	if err != nil {
+		return err
+	}
+	decoderOut, err := decoder.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	decoder.Stderr = os.Stderr
+	if err = decoder.Start(); err != nil {
+		return err
+	}
+	go mjpegFeeder(decoderIn)
+	go func() {
+		defer blackBoxOnPanic()
+		mjpegReader(decoderOut)
+		if err := decoder.Wait(); err != nil {
+			log.Printf("ffmpeg exited - %v\n", err)
+		}
+		// wake every client so that it can give up
+		mjpegFrames.Lock()
+		mjpegFrames.done = true
+		mjpegFrames.cond.Broadcast()
+		mjpegFrames.Unlock()
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(mjpegPath, mjpegHandler)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><head><title>Tello</title></head><body style=\"margin:0;background:black\">"+
+			"<img src=\"%s\" style=\"width:100%%\"></body></html>", mjpegPath)
+	})
+	go func() {
+		log.Printf("Serving MJPEG preview on http://%s/\n", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("MJPEG server stopped - %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// writeOverlay replaces the overlay text file atomically so that ffmpeg never sees a partial update
+func writeOverlay(path string) {
+	flightDataMu.RLock()
+	st := getStatusText()
+	flightDataMu.RUnlock()
+	text := strings.Join([]string{st.ht, st.bp, st.ws, st.msg}, "\n")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(text), 0644); err != nil {
+		log.Printf("Error writing overlay %v\n", err)
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+// mjpegFeeder passes the video to ffmpeg, which copes with resolution changes by itself
+func mjpegFeeder(decoderIn io.WriteCloser) {
+	defer blackBoxOnPanic()
+	for {
+		if err := feedVideo("mjpeg", decoderIn, nil); err != nil {
+			log.Printf("Error writing to ffmpeg, MJPEG stream stopped - %v\n", err)
+			// make sure that ffmpeg exits, so that the clients are told
+			decoderIn.Close()
+			return
+		}
+	}
+}
+
+// mjpegReader splits ffmpeg's output into individual JPEG images until it stops
+func mjpegReader(decoderOut io.Reader) {
+	var buf []byte
+	chunk := make([]byte, mjpegReadBuf)
+	for {
+		n, err := decoderOut.Read(chunk)
+		if err != nil {
+			log.Printf("MJPEG decoder stopped - %v\n", err)
+			return
+		}
+		buf = append(buf, chunk[:n]...)
+		for {
+			start := bytes.Index(buf, jpegSOI)
+			if start < 0 {
+				// keep the last byte in case it is the first half of a start marker
+				if len(buf) > 1 {
+					buf = buf[len(buf)-1:]
+				}
+				break
+			}
+			end := bytes.Index(buf[start+2:], jpegEOI)
+			if end < 0 {
+				buf = buf[start:]
+				break
+			}
+			end += start + 2 + len(jpegEOI)
+			frame := append([]byte(nil), buf[start:end]...)
+			buf = buf[end:]
+			mjpegFrames.Lock()
+			mjpegFrames.frame = frame
+			mjpegFrames.seq++
+			mjpegFrames.cond.Broadcast()
+			mjpegFrames.Unlock()
+		}
+	}
+}
+
+func mjpegHandler(w http.ResponseWriter, r *http.Request) {
+	mjpegFrames.Lock()
+	done := mjpegFrames.done
+	mjpegFrames.Unlock()
+	if done {
+		http.Error(w, "MJPEG stream stopped", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	// wake this client when it disconnects, rather than when the next frame arrives
+	ctx := r.Context()
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mjpegFrames.Lock()
+			mjpegFrames.cond.Broadcast()
+			mjpegFrames.Unlock()
+		case <-finished:
+		}
+	}()
+	var seen uint64
+	for {
+		mjpegFrames.Lock()
+		for mjpegFrames.seq == seen && !mjpegFrames.done && ctx.Err() == nil {
+			mjpegFrames.cond.Wait()
+		}
+		frame, seq, done := mjpegFrames.frame, mjpegFrames.seq, mjpegFrames.done
+		mjpegFrames.Unlock()
+		if done || ctx.Err() != nil {
+			return
+		}
+		seen = seq
+		_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, len(frame))
+		if err == nil {
+			_, err = w.Write(frame)
+		}
+		if err == nil {
+			_, err = w.Write([]byte("\r\n"))
+		}
+		if err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
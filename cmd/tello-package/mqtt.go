@@ -0,0 +1,175 @@
+// mqtt.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/SMerrony/tello"
+)
+
+const (
+	mqttQueueLen = 64
+	mqttTimeout  = 5 * time.Second
+)
+
+// mqttMsg is one message waiting to be published
+type mqttMsg struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// mqttFlightData is the JSON payload of the flight data topic
+type mqttFlightData struct {
+	Time time.Time
+	tello.FlightData
+}
+
+var (
+	mqttClient mqtt.Client
+	mqttChan   chan mqttMsg
+
+	// the full topic names, set from the -mqtt* flags
+	mqttFlightDataTopic, mqttEventTopic, mqttMessageTopic, mqttStatusTopic, mqttCommandTopic string
+)
+
+// mqttTopic puts the -mqttprefix in front of a topic name
+func mqttTopic(name string) string {
+	if *mqttPrefixFlag == "" {
+		return name
+	}
+	return *mqttPrefixFlag + "/" + name
+}
+
+func startMQTT(broker string) error {
+	mqttFlightDataTopic = mqttTopic(*mqttFlightDataFlag)
+	mqttEventTopic = mqttTopic(*mqttEventFlag)
+	mqttMessageTopic = mqttTopic(*mqttMessageFlag)
+	mqttStatusTopic = mqttTopic(*mqttStatusFlag)
+	mqttCommandTopic = mqttTopic(*mqttCommandFlag)
+	host, _ := os.Hostname()
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(fmt.Sprintf("tello-desktop-%s-%d", host, os.Getpid())).
+		SetAutoReconnect(true).
+		SetWill(mqttStatusTopic, "offline", 1, true).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			// (re)subscribe on every connection as the broker may have forgotten us
+			c.Subscribe(mqttCommandTopic, 1, mqttCommandHandler)
+			c.Publish(mqttStatusTopic, 1, true, "online")
+			log.Printf("Connected to MQTT broker %s\n", broker)
+		}).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			log.Printf("Lost connection to MQTT broker - %v\n", err)
+		})
+	mqttClient = mqtt.NewClient(opts)
+	tok := mqttClient.Connect()
+	if !tok.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("timed out connecting to %s", broker)
+	}
+	if err := tok.Error(); err != nil {
+		return err
+	}
+	mqttChan = make(chan mqttMsg, mqttQueueLen)
+	go mqttPublisher()
+	return nil
+}
+
+func stopMQTT() {
+	if mqttClient == nil {
+		return
+	}
+	mqttClient.Publish(mqttStatusTopic, 1, true, "offline").WaitTimeout(mqttTimeout)
+	mqttClient.Disconnect(250)
+}
+
+func mqttPublisher() {
+	defer blackBoxOnPanic()
+	for m := range mqttChan {
+		mqttClient.Publish(m.topic, 0, m.retained, m.payload)
+	}
+}
+
+// queueMQTT never blocks as it is called from the flight data goroutine
+func queueMQTT(topic string, retained bool, payload []byte) {
+	select {
+	case mqttChan <- mqttMsg{topic: topic, retained: retained, payload: payload}:
+	default:
+		log.Println("MQTT queue full, message dropped")
+	}
+}
+
+// publishFlightData must be called with flightDataMu held
+func publishFlightData(ev flightEvent, msgChanged bool) {
+	if mqttChan == nil {
+		return
+	}
+	fd, err := json.Marshal(mqttFlightData{Time: time.Now(), FlightData: flightData})
+	if err != nil {
+		log.Printf("Error encoding flight data for MQTT %v\n", err)
+		return
+	}
+	queueMQTT(mqttFlightDataTopic, false, fd)
+	if ev != noEvent {
+		queueMQTT(mqttEventTopic, false, []byte(ev.String()))
+	}
+	if msgChanged {
+		publishMessage(flightMsg)
+	}
+}
+
+// publishMessage sends a new status message, it must be called with flightDataMu held so that
+// messages are published in the order they are set
+func publishMessage(msg string) {
+	if mqttChan == nil {
+		return
+	}
+	queueMQTT(mqttMessageTopic, true, []byte(msg))
+}
+
+// mqttCommandHandler acts on the discrete commands received on the command topic
+func mqttCommandHandler(c mqtt.Client, m mqtt.Message) {
+	cmd := strings.ToLower(strings.TrimSpace(string(m.Payload())))
+	log.Printf("MQTT command received: %s\n", cmd)
+	switch cmd {
+	case "takeoff":
+		drone.TakeOff()
+	case "land":
+		drone.Land()
+	case "hover":
+		drone.Hover()
+	case "photo":
+		drone.TakePicture()
+	default:
+		log.Printf("Unknown MQTT command: %s\n", cmd)
+		return
+	}
+	commandIssued(mqttSrc, cmd)
+}
@@ -0,0 +1,39 @@
+// nowindow.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build nosdl
+// +build nosdl
+
+package main
+
+// Built with -tags nosdl there is no SDL window, so the terminal UI is always used
+// and none of these are ever called.
+
+const haveWindow = false
+
+func setupWindow()                                               {}
+func updateWindow()                                              {}
+func sdlEventListener()                                          {}
+func openJoystick()                                              {}
+func openTrainerJoysticks() (instructor, student int32, ok bool) { return 0, 0, false }
+func startTextInput()                                            {}
+func stopTextInput()                                             {}
+func closeWindow()                                               {}
@@ -0,0 +1,182 @@
+// player.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// startPlayer runs an external mplayer instance fed from the video bus.
+// If mplayer goes away the rest of the program carries on without it.
+func startPlayer(x11 bool) error {
+	player, playerIn, err := launchPlayer(x11)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer blackBoxOnPanic()
+		for {
+			err := feedVideo("player", playerIn, nil)
+			playerIn.Close()
+			if err != nil {
+				playerWriteErrors.Inc()
+				log.Printf("Error writing to mplayer %v, video display stopped\n", err)
+				setFlightMsg("Video player stopped")
+				addWarning("Video player stopped")
+				player.Wait()
+				return
+			}
+			// mplayer does not cope with the resolution changing mid-stream, so start a fresh one
+			player.Process.Kill()
+			player.Wait()
+			if player, playerIn, err = launchPlayer(x11); err != nil {
+				log.Printf("Unable to restart mplayer - %v\n", err)
+				setFlightMsg("Video player stopped")
+				addWarning("Video player stopped")
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// launchPlayer starts mplayer reading H.264 from its stdin.
+// The -vo X11 parm allows it to run nicely inside a virtual machine,
+// setting the FPS to 60 seems to produce smoother video.
+func launchPlayer(x11 bool) (player *exec.Cmd, playerIn io.WriteCloser, err error) {
+	if x11 {
+		player = exec.Command("mplayer", "-nosound", "-vo", "x11", "-fps", "60", "-")
+	} else {
+		player = exec.Command("mplayer", "-nosound", "-fps", "60", "-")
+	}
+	if playerIn, err = player.StdinPipe(); err != nil {
+		return nil, nil, err
+	}
+	if err = player.Start(); err != nil {
+		return nil, nil, err
+	}
+	return player, playerIn, nil
+}
+
+const recordingFileFmt = "tello-video-2006-01-02-150405.h264"
+
+var (
+	recorderMu   sync.Mutex
+	recorderStop chan struct{} // nil when not recording
+)
+
+var errFeedStopped = errors.New("stopped")
+
+// startRecorder saves the raw H.264 stream to a file which starts at a keyframe,
+// resolution changes are simply recorded in-band
+func startRecorder(filename string) error {
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	if recorderStop != nil {
+		return errors.New("already recording")
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recording video to %s\n", filename)
+	addRecording("Video: " + filename)
+	stop := make(chan struct{})
+	recorderStop = stop
+	go func() {
+		defer blackBoxOnPanic()
+		defer f.Close()
+		for {
+			err := feedVideo("recorder", f, stop)
+			switch err {
+			case nil:
+				continue
+			case errFeedStopped:
+				log.Printf("Recording to %s stopped\n", filename)
+			default:
+				log.Printf("Error writing video to %s %v, recording stopped\n", filename, err)
+				setFlightMsg("Video recording stopped")
+				addWarning("Video recording stopped")
+				recorderMu.Lock()
+				if recorderStop == stop {
+					recorderStop = nil
+				}
+				recorderMu.Unlock()
+			}
+			return
+		}
+	}()
+	return nil
+}
+
+// stopRecorder ends the recording, if there is one
+func stopRecorder() {
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	if recorderStop != nil {
+		close(recorderStop)
+		recorderStop = nil
+	}
+}
+
+func recordingVideo() bool {
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	return recorderStop != nil
+}
+
+// toggleRecording starts recording to a new time-stamped file, or stops the recording
+func toggleRecording() {
+	if recordingVideo() {
+		stopRecorder()
+		return
+	}
+	if err := startRecorder(time.Now().Format(recordingFileFmt)); err != nil {
+		log.Printf("Unable to start video recording - %v\n", err)
+	}
+}
+
+// feedVideo copies frames from the video bus to w until a write fails, stop is closed,
+// or the bus closes the subscription because the format has changed, in which case it returns nil
+func feedVideo(name string, w io.Writer, stop <-chan struct{}) error {
+	vs := subscribeVideo(name)
+	defer unsubscribeVideo(vs)
+	for {
+		select {
+		case <-stop:
+			return errFeedStopped
+		case au, ok := <-vs.frames:
+			if !ok {
+				return nil
+			}
+			if _, err := w.Write(au); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// report.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// A summary of the session is kept as it goes along and written out as a report
+// (and printed) by exitNicely.
+
+const reportTimeFmt = "15:04:05"
+
+type flightRecord struct {
+	TakeOff, Landing               time.Time // Landing is zero if the drone was still flying
+	BatteryTakeOff, BatteryLanding int8
+}
+
+// Duration is the length of the flight, so far if the drone is still flying
+func (f flightRecord) Duration() time.Duration {
+	if f.Landing.IsZero() {
+		return time.Since(f.TakeOff).Round(time.Second)
+	}
+	return f.Landing.Sub(f.TakeOff).Round(time.Second)
+}
+
+type sessionWarning struct {
+	Time time.Time
+	Msg  string
+}
+
+type sessionStats struct {
+	mu           sync.Mutex
+	start        time.Time
+	flights      []flightRecord
+	maxHeight    int16 // dm
+	maxSpeed     float64
+	haveData     bool
+	batteryStart int8
+	batteryEnd   int8
+	minWifi      uint8
+	warnings     []sessionWarning
+	incidents    []sessionWarning
+	photos       int
+	recordings   []string
+}
+
+var session = sessionStats{start: time.Now()}
+
+// recordSession is called with every flight data update
+func recordSession(ev flightEvent, fd tello.FlightData) {
+	if !haveFlightData(&fd) {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	now := time.Now()
+	switch ev {
+	case takeOffEvent:
+		session.flights = append(session.flights, flightRecord{TakeOff: now, BatteryTakeOff: fd.BatteryPercentage})
+	case landingEvent:
+		if n := len(session.flights); n > 0 {
+			session.flights[n-1].Landing = now
+			session.flights[n-1].BatteryLanding = fd.BatteryPercentage
+		}
+	}
+	if !session.haveData {
+		session.haveData = true
+		session.batteryStart = fd.BatteryPercentage
+		session.minWifi = fd.WifiStrength
+	}
+	session.batteryEnd = fd.BatteryPercentage
+	if fd.WifiStrength < session.minWifi {
+		session.minWifi = fd.WifiStrength
+	}
+	if fd.Height > session.maxHeight {
+		session.maxHeight = fd.Height
+	}
+	speed := horizSpeedMS(&fd)
+	if speed > session.maxSpeed {
+		session.maxSpeed = speed
+	}
+}
+
+// addWarning notes a warning for the report
+func addWarning(msg string) {
+	session.mu.Lock()
+	session.warnings = append(session.warnings, sessionWarning{Time: time.Now(), Msg: msg})
+	session.mu.Unlock()
+}
+
+// addIncident notes a black box incident, which is also a warning
+func addIncident(reason string) {
+	session.mu.Lock()
+	now := time.Now()
+	session.incidents = append(session.incidents, sessionWarning{Time: now, Msg: reason})
+	session.warnings = append(session.warnings, sessionWarning{Time: now, Msg: "Incident: " + reason})
+	session.mu.Unlock()
+}
+
+// addRecording notes a video recording or black box saved during the session
+func addRecording(what string) {
+	session.mu.Lock()
+	session.recordings = append(session.recordings, what)
+	session.mu.Unlock()
+}
+
+func addPhoto() {
+	session.mu.Lock()
+	session.photos++
+	session.mu.Unlock()
+}
+
+// airtime totals the flights, counting one still in progress up to now
+func (ss *sessionStats) airtime() (total time.Duration) {
+	for _, f := range ss.flights {
+		if f.Landing.IsZero() {
+			total += time.Since(f.TakeOff)
+		} else {
+			total += f.Landing.Sub(f.TakeOff)
+		}
+	}
+	return total
+}
+
+// reportData is the session summary ready for printing
+type reportData struct {
+	Title      string
+	Summary    [][2]string
+	Flights    []flightRecord
+	Warnings   []sessionWarning
+	Recordings []string
+}
+
+func getReportData() (rd reportData) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	end := time.Now()
+	rd.Title = fmt.Sprintf("Tello flight report %s", session.start.Format("2006-01-02 15:04"))
+	rd.Summary = [][2]string{
+		{"Session", fmt.Sprintf("%s - %s", session.start.Format(reportTimeFmt), end.Format(reportTimeFmt))},
+		{"Flights", fmt.Sprintf("%d", len(session.flights))},
+		{"Airtime", session.airtime().Round(time.Second).String()},
+		{"Max height", fmt.Sprintf("%.1fm", float32(session.maxHeight)/10)},
+		{"Max speed", fmt.Sprintf("%.1f m/s", session.maxSpeed)},
+		{"Battery used", fmt.Sprintf("%d%% (%d%% to %d%%)", session.batteryStart-session.batteryEnd,
+			session.batteryStart, session.batteryEnd)},
+		{"Min WiFi strength", fmt.Sprintf("%d", session.minWifi)},
+		{"Photos", fmt.Sprintf("%d", session.photos)},
+	}
+	rd.Flights = append(rd.Flights, session.flights...)
+	rd.Warnings = append(rd.Warnings, session.warnings...)
+	rd.Recordings = append(rd.Recordings, session.recordings...)
+	return rd
+}
+
+func (rd reportData) markdown() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", rd.Title)
+	for _, s := range rd.Summary {
+		fmt.Fprintf(&b, "- %s: %s\n", s[0], s[1])
+	}
+	if len(rd.Flights) > 0 {
+		fmt.Fprintf(&b, "\n## Flights\n\n| Take off | Landing | Duration | Battery |\n|---|---|---|---|\n")
+		for _, f := range rd.Flights {
+			landing := "still flying"
+			if !f.Landing.IsZero() {
+				landing = f.Landing.Format(reportTimeFmt)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %d%% - %d%% |\n", f.TakeOff.Format(reportTimeFmt), landing,
+				f.Duration(), f.BatteryTakeOff, f.BatteryLanding)
+		}
+	}
+	if len(rd.Warnings) > 0 {
+		fmt.Fprintf(&b, "\n## Warnings\n\n")
+		for _, w := range rd.Warnings {
+			fmt.Fprintf(&b, "- %s %s\n", w.Time.Format(reportTimeFmt), w.Msg)
+		}
+	}
+	if len(rd.Recordings) > 0 {
+		fmt.Fprintf(&b, "\n## Recordings\n\n")
+		for _, r := range rd.Recordings {
+			fmt.Fprintf(&b, "- %s\n", r)
+		}
+	}
+	return b.String()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"hms": func(t time.Time) string {
+		if t.IsZero() {
+			return "still flying"
+		}
+		return t.Format(reportTimeFmt)
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head><body>
+<h1>{{.Title}}</h1>
+<table>{{range .Summary}}<tr><th align="left">{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Flights}}<h2>Flights</h2>
+<table><tr><th>Take off</th><th>Landing</th><th>Duration</th><th>Battery</th></tr>
+{{range .Flights}}<tr><td>{{hms .TakeOff}}</td><td>{{hms .Landing}}</td><td>{{.Duration}}</td><td>{{.BatteryTakeOff}}% - {{.BatteryLanding}}%</td></tr>
+{{end}}</table>{{end}}
+{{if .Warnings}}<h2>Warnings</h2>
+<ul>{{range .Warnings}}<li>{{hms .Time}} {{.Msg}}</li>
+{{end}}</ul>{{end}}
+{{if .Recordings}}<h2>Recordings</h2>
+<ul>{{range .Recordings}}<li>{{.}}</li>
+{{end}}</ul>{{end}}
+</body></html>
+`))
+
+// writeReport prints the session report and saves it in the given format, "md" or "html"
+func writeReport(format string) {
+	rd := getReportData()
+	md := rd.markdown()
+	fmt.Print("\n" + md)
+	if format == "" {
+		return
+	}
+	var b bytes.Buffer
+	switch format {
+	case "html":
+		if err := reportTemplate.Execute(&b, rd); err != nil {
+			log.Printf("Error formatting flight report - %v\n", err)
+			return
+		}
+	default:
+		b.WriteString(md)
+	}
+	filename := fmt.Sprintf("tello-report-%s.%s", session.start.Format("2006-01-02-150405"), format)
+	if err := os.WriteFile(filename, b.Bytes(), 0644); err != nil {
+		log.Printf("Error saving flight report - %v\n", err)
+		return
+	}
+	fmt.Printf("\nFlight report saved in %s\n", filename)
+}
@@ -0,0 +1,410 @@
+// rtsp.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A small RTSP server which re-streams the Tello video to any number of players on the LAN.
+// Both UDP and TCP-interleaved RTP transports are supported, there is a single H.264 track.
+
+const (
+	rtpPayloadType = 96
+	rtpClockRate   = 90000
+	rtpMaxPayload  = 1400
+	rtpHeaderLen   = 12
+	nalFUA         = 28
+	rtspServerName = "tello-desktop"
+	rtpPortTries   = 10 // attempts to find a free pair of UDP ports
+)
+
+// rtspSession is the state of one RTSP client connection
+type rtspSession struct {
+	id        string
+	conn      net.Conn
+	writeMu   sync.Mutex // RTSP responses and interleaved RTP share the connection
+	udp       *net.UDPConn
+	rtcp      *net.UDPConn // on the port after udp, receiver reports are read and ignored
+	udpDest   *net.UDPAddr
+	tcpChan   int // interleaved channel for RTP, or -1 when using UDP
+	ssrc      uint32
+	seq       uint16
+	playing   bool
+	stopChan  chan struct{}
+	startTime time.Time
+}
+
+// rtpDest is where a playing session's RTP goes, it is copied when PLAY starts the stream so
+// that the streaming goroutine never reads the session's transport while SETUP may change it
+type rtpDest struct {
+	tcpChan int
+	udp     *net.UDPConn
+	udpAddr *net.UDPAddr
+}
+
+func startRTSP(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("RTSP server listening on rtsp://%s/tello\n", lis.Addr())
+	go func() {
+		defer blackBoxOnPanic()
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				log.Printf("RTSP server stopped - %v\n", err)
+				return
+			}
+			go rtspServe(conn)
+		}
+	}()
+	return nil
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func rtspServe(conn net.Conn) {
+	defer blackBoxOnPanic()
+	sess := &rtspSession{conn: conn, tcpChan: -1, ssrc: randomUint32(), seq: uint16(randomUint32())}
+	var idBytes [8]byte
+	rand.Read(idBytes[:])
+	sess.id = hex.EncodeToString(idBytes[:])
+	log.Printf("RTSP client connected from %s\n", conn.RemoteAddr())
+	defer func() {
+		sess.stop()
+		conn.Close()
+		log.Printf("RTSP client %s disconnected\n", conn.RemoteAddr())
+	}()
+
+	rdr := bufio.NewReader(conn)
+	tp := textproto.NewReader(rdr)
+	for {
+		// interleaved RTCP from TCP clients is read and ignored
+		if b, err := rdr.Peek(1); err == nil && b[0] == '$' {
+			var hdr [4]byte
+			if _, err := io.ReadFull(rdr, hdr[:]); err != nil {
+				return
+			}
+			if _, err := rdr.Discard(int(binary.BigEndian.Uint16(hdr[2:]))); err != nil {
+				return
+			}
+			continue
+		}
+		reqLine, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		if reqLine == "" {
+			continue
+		}
+		hdrs, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		if cl, _ := strconv.Atoi(hdrs.Get("Content-Length")); cl > 0 {
+			if _, err := rdr.Discard(cl); err != nil {
+				return
+			}
+		}
+		parts := strings.Fields(reqLine)
+		if len(parts) != 3 {
+			return
+		}
+		if !sess.handle(parts[0], parts[1], hdrs) {
+			return
+		}
+	}
+}
+
+func (sess *rtspSession) reply(cseq string, status string, hdrs []string, body string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "RTSP/1.0 %s\r\nCSeq: %s\r\nServer: %s\r\n", status, cseq, rtspServerName)
+	for _, h := range hdrs {
+		sb.WriteString(h + "\r\n")
+	}
+	if body != "" {
+		fmt.Fprintf(&sb, "Content-Length: %d\r\n", len(body))
+	}
+	sb.WriteString("\r\n" + body)
+	sess.writeMu.Lock()
+	sess.conn.Write([]byte(sb.String()))
+	sess.writeMu.Unlock()
+}
+
+// handle acts on one request, it returns false if the connection should be closed
+func (sess *rtspSession) handle(method, url string, hdrs textproto.MIMEHeader) bool {
+	cseq := hdrs.Get("CSeq")
+	sessHdr := "Session: " + sess.id + ";timeout=60"
+	switch method {
+	case "OPTIONS":
+		sess.reply(cseq, "200 OK", []string{"Public: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN, GET_PARAMETER"}, "")
+	case "DESCRIBE":
+		sess.reply(cseq, "200 OK", []string{
+			"Content-Type: application/sdp",
+			"Content-Base: " + strings.TrimSuffix(url, "/") + "/",
+		}, rtspSDP(sess.conn.LocalAddr()))
+	case "SETUP":
+		transport, err := sess.setup(hdrs.Get("Transport"))
+		if err != nil {
+			log.Printf("RTSP SETUP failed - %v\n", err)
+			sess.reply(cseq, "461 Unsupported Transport", nil, "")
+			return true
+		}
+		sess.reply(cseq, "200 OK", []string{"Transport: " + transport, sessHdr}, "")
+	case "PLAY":
+		if sess.tcpChan < 0 && sess.udpDest == nil {
+			sess.reply(cseq, "455 Method Not Valid in This State", nil, "")
+			return true
+		}
+		sess.reply(cseq, "200 OK", []string{sessHdr, "Range: npt=0.000-"}, "")
+		sess.play()
+	case "TEARDOWN":
+		sess.reply(cseq, "200 OK", []string{sessHdr}, "")
+		return false
+	case "GET_PARAMETER":
+		sess.reply(cseq, "200 OK", []string{sessHdr}, "")
+	default:
+		sess.reply(cseq, "501 Not Implemented", nil, "")
+	}
+	return true
+}
+
+// rtspSDP describes our single video track, the parameter sets are included if we have seen them
+func rtspSDP(local net.Addr) string {
+	host, _, _ := net.SplitHostPort(local.String())
+	fmtp := "packetization-mode=1"
+	sps, pps := getParamSets()
+	if sps != nil && pps != nil {
+		spsNAL, ppsNAL := splitAnnexB(sps), splitAnnexB(pps)
+		if len(spsNAL) == 1 && len(ppsNAL) == 1 && len(spsNAL[0]) >= 4 {
+			fmtp += fmt.Sprintf(";profile-level-id=%s;sprop-parameter-sets=%s,%s",
+				hex.EncodeToString(spsNAL[0][1:4]),
+				base64.StdEncoding.EncodeToString(spsNAL[0]),
+				base64.StdEncoding.EncodeToString(ppsNAL[0]))
+		}
+	}
+	return "v=0\r\n" +
+		"o=- 0 0 IN IP4 " + host + "\r\n" +
+		"s=Tello\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"t=0 0\r\n" +
+		fmt.Sprintf("m=video 0 RTP/AVP %d\r\n", rtpPayloadType) +
+		fmt.Sprintf("a=rtpmap:%d H264/%d\r\n", rtpPayloadType, rtpClockRate) +
+		fmt.Sprintf("a=fmtp:%d %s\r\n", rtpPayloadType, fmtp) +
+		"a=control:trackID=0\r\n"
+}
+
+// setup chooses the transport requested by the client and returns our reply Transport header
+func (sess *rtspSession) setup(transport string) (string, error) {
+	for _, spec := range strings.Split(transport, ",") {
+		params := strings.Split(spec, ";")
+		switch strings.TrimSpace(params[0]) {
+		case "RTP/AVP/TCP":
+			sess.tcpChan = 0
+			for _, p := range params[1:] {
+				if strings.HasPrefix(p, "interleaved=") {
+					fmt.Sscanf(strings.TrimPrefix(p, "interleaved="), "%d", &sess.tcpChan)
+				}
+			}
+			return fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", sess.tcpChan, sess.tcpChan+1), nil
+		case "RTP/AVP", "RTP/AVP/UDP":
+			var rtpPort, rtcpPort int
+			for _, p := range params[1:] {
+				if strings.HasPrefix(p, "client_port=") {
+					fmt.Sscanf(strings.TrimPrefix(p, "client_port="), "%d-%d", &rtpPort, &rtcpPort)
+				}
+			}
+			if rtpPort == 0 {
+				continue
+			}
+			host, _, _ := net.SplitHostPort(sess.conn.RemoteAddr().String())
+			dest, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(rtpPort)))
+			if err != nil {
+				return "", err
+			}
+			if sess.udp == nil {
+				if sess.udp, sess.rtcp, err = listenRTPPair(); err != nil {
+					return "", err
+				}
+				go discardRTCP(sess.rtcp)
+			}
+			sess.udpDest = dest
+			serverPort := sess.udp.LocalAddr().(*net.UDPAddr).Port
+			return fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d;server_port=%d-%d;ssrc=%08X",
+				rtpPort, rtcpPort, serverPort, serverPort+1, sess.ssrc), nil
+		}
+	}
+	return "", fmt.Errorf("no supported transport in %q", transport)
+}
+
+func (sess *rtspSession) play() {
+	if sess.playing {
+		return
+	}
+	sess.playing = true
+	sess.stopChan = make(chan struct{})
+	sess.startTime = time.Now()
+	go sess.stream(rtpDest{tcpChan: sess.tcpChan, udp: sess.udp, udpAddr: sess.udpDest})
+}
+
+func (sess *rtspSession) stop() {
+	if sess.playing {
+		close(sess.stopChan)
+		sess.playing = false
+	}
+	if sess.udp != nil {
+		sess.udp.Close()
+		sess.rtcp.Close()
+	}
+}
+
+// listenRTPPair binds an even UDP port for RTP and the next one for RTCP, as RTSP clients expect
+func listenRTPPair() (rtp, rtcp *net.UDPConn, err error) {
+	for i := 0; i < rtpPortTries; i++ {
+		if rtp, err = net.ListenUDP("udp", nil); err != nil {
+			return nil, nil, err
+		}
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		if port%2 == 0 {
+			if rtcp, err = net.ListenUDP("udp", &net.UDPAddr{Port: port + 1}); err == nil {
+				return rtp, rtcp, nil
+			}
+		}
+		rtp.Close()
+	}
+	return nil, nil, fmt.Errorf("no free pair of UDP ports for RTP after %d attempts", rtpPortTries)
+}
+
+// discardRTCP reads the client's receiver reports until the socket is closed
+func discardRTCP(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := conn.ReadFromUDP(buf); err != nil {
+			return
+		}
+	}
+}
+
+// stream sends video from the next keyframe onwards
+func (sess *rtspSession) stream(dest rtpDest) {
+	defer blackBoxOnPanic()
+	vs := subscribeVideo("rtsp-" + sess.conn.RemoteAddr().String())
+	defer unsubscribeVideo(vs)
+	for {
+		select {
+		case <-sess.stopChan:
+			return
+		case au, ok := <-vs.frames:
+			if !ok {
+				// the SDP we sent is out of date, make the client reconnect
+				log.Printf("Video format changed, closing RTSP session with %s\n", sess.conn.RemoteAddr())
+				sess.conn.Close()
+				return
+			}
+			ts := uint32(time.Since(sess.startTime).Seconds() * rtpClockRate)
+			if err := sess.sendAccessUnit(dest, au, ts); err != nil {
+				log.Printf("Error sending RTP to %s - %v\n", sess.conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+// sendAccessUnit packetises one frame as per RFC 6184, using FU-A for NAL units that are too big
+func (sess *rtspSession) sendAccessUnit(dest rtpDest, au []byte, ts uint32) error {
+	nals := splitAnnexB(au)
+	for n, nal := range nals {
+		last := n == len(nals)-1
+		if len(nal) <= rtpMaxPayload {
+			if err := sess.sendRTP(dest, nal, ts, last); err != nil {
+				return err
+			}
+			continue
+		}
+		fuIndicator := nal[0]&0xE0 | nalFUA
+		for data, first := nal[1:], true; len(data) > 0; first = false {
+			chunk := len(data)
+			if chunk > rtpMaxPayload-2 {
+				chunk = rtpMaxPayload - 2
+			}
+			fuHeader := nal[0] & 0x1F
+			if first {
+				fuHeader |= 0x80
+			}
+			end := chunk == len(data)
+			if end {
+				fuHeader |= 0x40
+			}
+			pl := append([]byte{fuIndicator, fuHeader}, data[:chunk]...)
+			if err := sess.sendRTP(dest, pl, ts, last && end); err != nil {
+				return err
+			}
+			data = data[chunk:]
+		}
+	}
+	return nil
+}
+
+func (sess *rtspSession) sendRTP(dest rtpDest, payload []byte, ts uint32, marker bool) error {
+	pkt := make([]byte, rtpHeaderLen, rtpHeaderLen+len(payload))
+	pkt[0] = 0x80 // version 2
+	pkt[1] = rtpPayloadType
+	if marker {
+		pkt[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(pkt[2:], sess.seq)
+	binary.BigEndian.PutUint32(pkt[4:], ts)
+	binary.BigEndian.PutUint32(pkt[8:], sess.ssrc)
+	pkt = append(pkt, payload...)
+	sess.seq++
+	if dest.tcpChan >= 0 {
+		frame := make([]byte, 4, 4+len(pkt))
+		frame[0] = '$'
+		frame[1] = byte(dest.tcpChan)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(pkt)))
+		sess.writeMu.Lock()
+		_, err := sess.conn.Write(append(frame, pkt...))
+		sess.writeMu.Unlock()
+		return err
+	}
+	_, err := dest.udp.WriteToUDP(pkt, dest.udpAddr)
+	return err
+}
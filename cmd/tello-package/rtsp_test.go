@@ -0,0 +1,141 @@
+// rtsp_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a SETUP while playing must not change where the stream already running sends its RTP
+func TestRTSPSetupWhilePlaying(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		if conn, err := lis.Accept(); err == nil {
+			rtspServe(conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	replies := make(chan string, 10)
+	channels := make(chan byte, 100)
+	go func() {
+		rdr := bufio.NewReader(conn)
+		for {
+			b, err := rdr.Peek(1)
+			if err != nil {
+				return
+			}
+			if b[0] == '$' {
+				var hdr [4]byte
+				if _, err := io.ReadFull(rdr, hdr[:]); err != nil {
+					return
+				}
+				if _, err := rdr.Discard(int(binary.BigEndian.Uint16(hdr[2:]))); err != nil {
+					return
+				}
+				select {
+				case channels <- hdr[1]:
+				default:
+				}
+				continue
+			}
+			status, err := rdr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			for {
+				line, err := rdr.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == "\r\n" {
+					break
+				}
+			}
+			replies <- strings.TrimSpace(status)
+		}
+	}()
+	request := func(cseq int, method, extra string) {
+		fmt.Fprintf(conn, "%s rtsp://localhost/tello RTSP/1.0\r\nCSeq: %d\r\n%s\r\n", method, cseq, extra)
+		select {
+		case status := <-replies:
+			if status != "RTSP/1.0 200 OK" {
+				t.Fatalf("%s got %q", method, status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no reply to %s", method)
+		}
+	}
+
+	request(1, "SETUP", "Transport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n")
+	request(2, "PLAY", "")
+	// the stream subscribes to the video bus in its own goroutine, keep publishing until it is sending
+	deadline := time.After(2 * time.Second)
+	for sending := false; !sending; {
+		publishAccessUnit(testIDR)
+		select {
+		case ch := <-channels:
+			if ch != 0 {
+				t.Fatalf("RTP sent on channel %d, want 0", ch)
+			}
+			sending = true
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no RTP received")
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			publishAccessUnit(testIDR)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	request(3, "SETUP", "Transport: RTP/AVP/TCP;unicast;interleaved=2-3\r\n")
+	<-done
+	for {
+		select {
+		case ch := <-channels:
+			if ch != 0 {
+				t.Fatalf("RTP sent on channel %d after a second SETUP, want 0", ch)
+			}
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+}
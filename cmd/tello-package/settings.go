@@ -0,0 +1,343 @@
+// settings.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+// The settings panel shows what the drone has told us about itself and lets some of it be changed.
+// It is driven by the cursor keys: Up/Down select, Enter edits the selected setting,
+// Left/Right (or typing) change it, Enter asks for confirmation, Y applies it and Esc backs out.
+// While it is open the flight keys are ignored, except for the panic key.
+
+const (
+	settingsTitle      = "Drone Settings  (I: close)"
+	minMaxHeight       = 2  // metres
+	maxMaxHeight       = 30 // metres
+	minExposure        = -9
+	maxExposure        = 9
+	minPasswordLen     = 8
+	maxSettingLength   = 32
+	settingsLineHeight = 30 // pixels in the SDL window
+)
+
+type settingsState int
+
+const (
+	settingsClosed settingsState = iota
+	settingsBrowsing
+	settingsEditing
+	settingsConfirming
+)
+
+// setting is one line of the panel, read-only if it has no apply func
+type setting struct {
+	name    string
+	current func() string
+	text    bool                    // edited by typing rather than stepping
+	step    func(val, dir int) int  // next value when stepping
+	format  func(val int) string    // how a stepped value is shown
+	initial func() int              // the starting value when stepping
+	check   func(val string) string // returns why the value is not acceptable
+	confirm string                  // extra warning when confirming
+	apply   func(val string, n int)
+}
+
+var (
+	settingsMu    sync.Mutex
+	settingsMode  settingsState
+	settingsSel   int
+	settingsText  string // the pending value of a text setting
+	settingsVal   int    // the pending value of a stepped setting
+	settingsMsg   string
+	exposureLevel int // the drone does not report it, so remember what we set
+)
+
+var settings = []setting{
+	{name: "Firmware", current: func() string { return droneInfo().Version }},
+	{
+		name: "SSID", current: func() string { return droneInfo().SSID }, text: true,
+		check: func(val string) string {
+			if val == "" {
+				return "SSID cannot be empty"
+			}
+			return ""
+		},
+		confirm: "The drone must be restarted to use it.",
+		apply: func(val string, n int) {
+			drone.SetSSID(val)
+			drone.GetSSID()
+		},
+	},
+	{
+		name: "WiFi Password", current: func() string { return "********" }, text: true,
+		check: func(val string) string {
+			if len(val) < minPasswordLen {
+				return fmt.Sprintf("Password must have at least %d characters", minPasswordLen)
+			}
+			return ""
+		},
+		confirm: "The drone must be restarted to use it.",
+		apply:   func(val string, n int) { drone.SetSSIDPassword(val) },
+	},
+	{
+		name: "Max Height", current: func() string { return fmt.Sprintf("%dm", droneInfo().MaxHeight) },
+		initial: func() int { return int(droneInfo().MaxHeight) },
+		step:    func(val, dir int) int { return clampInt(val+dir, minMaxHeight, maxMaxHeight) },
+		format:  func(val int) string { return fmt.Sprintf("%dm", val) },
+		apply: func(val string, n int) {
+			drone.SetMaxHeight(n)
+			drone.GetMaxHeight()
+		},
+	},
+	{
+		name: "Exposure", current: func() string { return fmt.Sprintf("EV %+d", exposureLevel) },
+		initial: func() int { return exposureLevel },
+		step:    func(val, dir int) int { return clampInt(val+dir, minExposure, maxExposure) },
+		format:  func(val int) string { return fmt.Sprintf("EV %+d", val) },
+		apply: func(val string, n int) {
+			if err := drone.SetExposure(n); err != nil {
+				settingsMsg = fmt.Sprintf("Exposure not set - %v", err)
+				return
+			}
+			exposureLevel = n
+		},
+	},
+	{
+		name: "Video Bitrate", current: bitrateText,
+		initial: bitrateChoice,
+		step:    func(val, dir int) int { return clampInt(val+dir, 0, len(vbrLevels)) },
+		format:  bitrateChoiceName,
+		apply:   func(val string, n int) { setBitrateChoice(n) },
+	},
+	{
+		name: "Video Mode", current: func() string { return videoModeName(wideVideo) },
+		initial: func() int { return boolToInt(wideVideo) },
+		step:    func(val, dir int) int { return clampInt(val+dir, 0, 1) },
+		format:  func(val int) string { return videoModeName(val == 1) },
+		apply:   func(val string, n int) { setVideoMode(n == 1) },
+	},
+}
+
+// droneInfo is what the drone has reported about itself
+type droneInfoData struct {
+	Version, SSID string
+	MaxHeight     uint8
+}
+
+func droneInfo() (di droneInfoData) {
+	flightDataMu.RLock()
+	defer flightDataMu.RUnlock()
+	return droneInfoData{Version: flightData.Version, SSID: flightData.SSID, MaxHeight: flightData.MaxHeight}
+}
+
+func videoModeName(wide bool) string {
+	if wide {
+		return "Wide (16:9)"
+	}
+	return "Normal (4:3)"
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func clampInt(v, lo, hi int) int {
+	switch {
+	case v < lo:
+		return lo
+	case v > hi:
+		return hi
+	}
+	return v
+}
+
+// settingsEditingText is true while the keyboard is being used to type a new value
+func settingsEditingText() bool {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	return settingsMode == settingsEditing && settings[settingsSel].text
+}
+
+func settingsOpen() bool {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	return settingsMode != settingsClosed
+}
+
+// toggleSettings opens or closes the panel, refreshing the drone's information when opening
+func toggleSettings() {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	if settingsMode != settingsClosed {
+		settingsMode = settingsClosed
+		stopTextInput()
+		return
+	}
+	settingsMode, settingsMsg = settingsBrowsing, ""
+	drone.GetVersion()
+	drone.GetSSID()
+	drone.GetMaxHeight()
+}
+
+// settingsKeyDown handles a key press while the panel is open
+func settingsKeyDown(key keyCode) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	s := &settings[settingsSel]
+	switch settingsMode {
+	case settingsBrowsing:
+		switch key {
+		case keyUp:
+			settingsSel = (settingsSel + len(settings) - 1) % len(settings)
+		case keyDown:
+			settingsSel = (settingsSel + 1) % len(settings)
+		case keyReturn:
+			if s.apply == nil {
+				settingsMsg = s.name + " cannot be changed"
+				return
+			}
+			settingsMode, settingsMsg = settingsEditing, ""
+			if s.text {
+				settingsText = ""
+				startTextInput()
+			} else {
+				settingsVal = s.initial()
+			}
+		case keyEscape:
+			settingsMode = settingsClosed
+		}
+	case settingsEditing:
+		switch key {
+		case keyLeft, keyDown:
+			if !s.text {
+				settingsVal = s.step(settingsVal, -1)
+			}
+		case keyRight, keyUp:
+			if !s.text {
+				settingsVal = s.step(settingsVal, 1)
+			}
+		case keyBackspace:
+			if s.text && len(settingsText) > 0 {
+				_, size := utf8.DecodeLastRuneInString(settingsText)
+				settingsText = settingsText[:len(settingsText)-size]
+			}
+		case keyReturn:
+			if s.text {
+				if why := s.check(settingsText); why != "" {
+					settingsMsg = why
+					return
+				}
+				stopTextInput()
+			}
+			settingsMode, settingsMsg = settingsConfirming, ""
+		case keyEscape:
+			stopTextInput()
+			settingsMode, settingsMsg = settingsBrowsing, ""
+		}
+	case settingsConfirming:
+		switch key {
+		case 'y':
+			settingsMsg = fmt.Sprintf("%s changed", s.name)
+			s.apply(settingsText, settingsVal)
+			settingsMode = settingsBrowsing
+		case 'n', keyEscape:
+			settingsMode, settingsMsg = settingsBrowsing, "Not changed"
+		}
+	}
+}
+
+// settingsPadAccept is the controller's X button, which enters and confirms changes
+func settingsPadAccept() {
+	settingsMu.Lock()
+	confirming := settingsMode == settingsConfirming
+	settingsMu.Unlock()
+	if confirming {
+		settingsKeyDown('y')
+	} else {
+		settingsKeyDown(keyReturn)
+	}
+}
+
+// settingsTyped adds typed text to the setting being edited, it returns false if no text is wanted
+func settingsTyped(text string) bool {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	if settingsMode != settingsEditing || !settings[settingsSel].text {
+		return false
+	}
+	if utf8.RuneCountInString(settingsText+text) <= maxSettingLength {
+		settingsText += text
+	}
+	return true
+}
+
+// settingsLines is the panel's contents for display
+func settingsLines() (lines []string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	lines = append(lines, settingsTitle, "")
+	for i := range settings {
+		s := &settings[i]
+		marker := "  "
+		if i == settingsSel {
+			marker = "> "
+		}
+		val := s.current()
+		if i == settingsSel && settingsMode != settingsBrowsing {
+			val = "[" + pendingSetting(s) + "]"
+		}
+		lines = append(lines, fmt.Sprintf("%s%-14s %s", marker, s.name+":", val))
+	}
+	lines = append(lines, "")
+	s := &settings[settingsSel]
+	switch settingsMode {
+	case settingsBrowsing:
+		lines = append(lines, "Up/Down: select  Enter: change")
+	case settingsEditing:
+		if s.text {
+			lines = append(lines, "Type the new value  Enter: done  Esc: cancel")
+		} else {
+			lines = append(lines, "Left/Right: change  Enter: done  Esc: cancel")
+		}
+	case settingsConfirming:
+		lines = append(lines, fmt.Sprintf("Set %s to %s? %s (Y/N)", s.name, pendingSetting(s), s.confirm))
+	}
+	if settingsMsg != "" {
+		lines = append(lines, settingsMsg)
+	}
+	return lines
+}
+
+// pendingSetting must be called with settingsMu held
+func pendingSetting(s *setting) string {
+	if s.text {
+		return settingsText
+	}
+	return s.format(settingsVal)
+}
@@ -0,0 +1,81 @@
+// telemetry.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import "sync"
+
+const (
+	chartSamplesPerSec = 20 // matches the 50ms flight data stream period
+	defaultChartSecs   = 60
+)
+
+// telemetrySample holds the charted values from one flight data update
+type telemetrySample struct {
+	height, battery, groundSpeed, wifiStrength float64
+}
+
+// telemetryRing is a fixed-size ring buffer of the most recent samples
+type telemetryRing struct {
+	mu      sync.Mutex
+	samples []telemetrySample
+	next    int
+	full    bool
+}
+
+var telemetry *telemetryRing
+
+func newTelemetryRing(secs int) *telemetryRing {
+	return &telemetryRing{samples: make([]telemetrySample, secs*chartSamplesPerSec)}
+}
+
+func (tr *telemetryRing) add(s telemetrySample) {
+	tr.mu.Lock()
+	tr.samples[tr.next] = s
+	tr.next++
+	if tr.next == len(tr.samples) {
+		tr.next = 0
+		tr.full = true
+	}
+	tr.mu.Unlock()
+}
+
+// snapshot returns a copy of the buffered samples, oldest first
+func (tr *telemetryRing) snapshot() []telemetrySample {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if !tr.full {
+		return append([]telemetrySample(nil), tr.samples[:tr.next]...)
+	}
+	snap := make([]telemetrySample, 0, len(tr.samples))
+	snap = append(snap, tr.samples[tr.next:]...)
+	return append(snap, tr.samples[:tr.next]...)
+}
+
+// addTelemetrySample must be called with flightDataMu held
+func addTelemetrySample() {
+	telemetry.add(telemetrySample{
+		height:       float64(flightData.Height) / 10,
+		battery:      float64(flightData.BatteryPercentage),
+		groundSpeed:  speedMS(flightData.GroundSpeed),
+		wifiStrength: float64(flightData.WifiStrength),
+	})
+}
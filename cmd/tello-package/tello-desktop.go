@@ -27,14 +27,12 @@ import (
 	"log"
 	"math"
 	"os"
-	"os/exec"
 	"os/signal"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/veandco/go-sdl2/sdl"
-	"github.com/veandco/go-sdl2/ttf"
+	"github.com/nsf/termbox-go"
 
 	"github.com/SMerrony/tello"
 )
@@ -43,29 +41,32 @@ const telloUDPport = "8890"
 
 // keyboard control mapping
 const (
-	bounceKey    = sdl.K_b
-	flipFwdKey   = sdl.K_1
-	flipBkwdKey  = sdl.K_2
-	flipLeftKey  = sdl.K_3
-	flipRightKey = sdl.K_4
-	helpKey      = sdl.K_h
-	landKey      = sdl.K_l
-	modeKey      = sdl.K_m
-	moveBkKey    = sdl.K_DOWN
-	moveDownKey  = sdl.K_s
-	moveFwdKey   = sdl.K_UP
-	moveLeftKey  = sdl.K_LEFT
-	moveRightKey = sdl.K_RIGHT
-	moveUpKey    = sdl.K_w
-	palmlandKey  = sdl.K_p
-	panicKey     = sdl.K_SPACE
-	quitKey      = sdl.K_q
-	takeOffKey   = sdl.K_t
-	takePhotoKey = sdl.K_f
-	throwKey     = sdl.K_o
-	turnLeftKey  = sdl.K_a
-	turnRightKey = sdl.K_d
-	videoModeKey = sdl.K_v
+	bounceKey    keyCode = 'b'
+	flipFwdKey   keyCode = '1'
+	flipBkwdKey  keyCode = '2'
+	flipLeftKey  keyCode = '3'
+	flipRightKey keyCode = '4'
+	helpKey      keyCode = 'h'
+	infoKey      keyCode = 'i'
+	landKey      keyCode = 'l'
+	macroPlayKey keyCode = 'g'
+	macroRecKey  keyCode = 'r'
+	modeKey      keyCode = 'm'
+	moveBkKey    keyCode = keyDown
+	moveDownKey  keyCode = 's'
+	moveFwdKey   keyCode = keyUp
+	moveLeftKey  keyCode = keyLeft
+	moveRightKey keyCode = keyRight
+	moveUpKey    keyCode = 'w'
+	palmlandKey  keyCode = 'p'
+	panicKey     keyCode = ' '
+	quitKey      keyCode = 'q'
+	takeOffKey   keyCode = 't'
+	takePhotoKey keyCode = 'f'
+	throwKey     keyCode = 'o'
+	turnLeftKey  keyCode = 'a'
+	turnRightKey keyCode = 'd'
+	videoModeKey keyCode = 'v'
 )
 
 const keyMoveIncr = 5000
@@ -82,27 +83,63 @@ const (
 	takeOffButton   = 2 // joystick.TrianglePress
 	takePhotoButton = 3 // square
 	turnLRAxis      = 0 // joystick.LeftX
+	menuButton      = 9 // options
 )
 
 const (
 	winTitle                                = "Tello Desktop"
-	winWidth, winHeight                     = 800, 600
+	winWidth, winHeight                     = 1200, 800
 	winUpdatePeriod                         = 333 * time.Millisecond
-	fontPath                                = "../../assets/Inconsolata-Bold.ttf"
 	bigFontSize, medFontSize, smallFontSize = 32, 24, 12
+	tuiLogFile                              = "tello-desktop.log"
 )
 
 // program flags
 var (
-	x11Flag     = flag.Bool("x11", false, "Use '-vo x11' flag in case mplayer takes over entire window")
-	joyHelpFlag = flag.Bool("joyhelp", false, "Print help for joystick control mapping and exit")
-	keyHelpFlag = flag.Bool("keyhelp", false, "Print help for keyboard control mapping and exit")
+	x11Flag            = flag.Bool("x11", false, "Use '-vo x11' flag in case mplayer takes over entire window")
+	joyHelpFlag        = flag.Bool("joyhelp", false, "Print help for joystick control mapping and exit")
+	keyHelpFlag        = flag.Bool("keyhelp", false, "Print help for keyboard control mapping and exit")
+	tuiFlag            = flag.Bool("tui", false, "Use a terminal UI instead of the SDL window (no video or joystick)")
+	fontFlag           = flag.String("font", "", "TrueType font file to use instead of the built-in font")
+	themeFlag          = flag.String("theme", "", "JSON file of colours for the status window")
+	audioFlag          = flag.Bool("audio", false, "Play audio cues for takeoff, landing and low battery")
+	calloutFlag        = flag.Int("callout", 30, "Seconds between spoken height and battery callouts in flight, 0 to disable")
+	mqttFlag           = flag.String("mqtt", "", "MQTT broker to publish telemetry to and take commands from, eg. tcp://localhost:1883")
+	mqttPrefixFlag     = flag.String("mqttprefix", "tello", "Prefix for all MQTT topics, empty for none")
+	mqttFlightDataFlag = flag.String("mqttflightdata", "flightdata", "MQTT topic for flight data, after the prefix")
+	mqttEventFlag      = flag.String("mqttevent", "event", "MQTT topic for takeoff and landing events, after the prefix")
+	mqttMessageFlag    = flag.String("mqttmessage", "message", "MQTT topic for status messages, after the prefix")
+	mqttStatusFlag     = flag.String("mqttstatus", "status", "MQTT topic for online/offline status, after the prefix")
+	mqttCommandFlag    = flag.String("mqttcommand", "command", "MQTT topic to take commands from, after the prefix")
+	mavlinkFlag        = flag.String("mavlink", "", "Ground control station to send MAVLink to, eg. 127.0.0.1:14550")
+	metricsFlag        = flag.String("metrics", "", "Address to serve Prometheus metrics on, eg. :9100")
+	rtspFlag           = flag.String("rtsp", "", "Address to serve the video over RTSP on, eg. :8554")
+	mjpegFlag          = flag.String("mjpeg", "", "Address to serve an MJPEG preview for browsers on, eg. :8080")
+	mjpegFPSFlag       = flag.Int("mjpegfps", 5, "Frame rate of the MJPEG preview")
+	mjpegWidthFlag     = flag.Int("mjpegwidth", 480, "Width of the MJPEG preview in pixels")
+	mjpegOverlayFlag   = flag.Bool("mjpegoverlay", false, "Overlay telemetry on the MJPEG preview")
+	bitrateFlag        = flag.String("bitrate", "4", "Video bitrate in Mb/s <1|1.5|2|3|4|auto>")
+	grpcFlag           = flag.String("grpc", "", "Address to serve the gRPC API on, eg. :50051")
+	recordFlag         = flag.String("record", "", "File to record the raw H.264 video to")
+	blackBoxFlag       = flag.String("blackbox", "blackbox", "Directory to save the black box to after an incident, empty to disable")
+	blackBoxSecsFlag   = flag.Int("blackboxsecs", 60, "Number of seconds kept in the black box")
+	reportFlag         = flag.String("report", "md", "Format to save the end of session flight report in <md|html>, empty for none")
+	logbookFlag        = flag.String("logbook", defaultLogbook, "Logbook file to add each session to, empty to disable")
+	batteryFlag        = flag.String("battery", "", "Label of the battery pack fitted, asked for at startup if -logbook is given without it")
+	trainerFlag        = flag.Bool("trainer", false, "Trainer mode - the first controller is the instructor's, the second the student's")
+	studentLimitFlag   = flag.Int("studentlimit", 100, "Percentage of full stick deflection allowed to the student in trainer mode")
+	studentRateFlag    = flag.Float64("studentrate", 0, "Full stick deflections per second allowed to the student in trainer mode, 0 for no limit")
+	beginnerFlag       = flag.Bool("beginner", false, "Beginner mode - reduced speed, no flips or sports mode, low ceiling and limited flight time")
+	beginnerSpdFlag    = flag.Int("beginnerspeed", 40, "Percentage of full speed allowed in beginner mode")
+	beginnerHtFlag     = flag.Float64("beginnerheight", 2, "Height ceiling in metres in beginner mode")
+	beginnerTimeFlag   = flag.Int("beginnertime", 120, "Seconds of flight before landing automatically in beginner mode, 0 for no limit")
+	macroFlag          = flag.String("macro", "tello-macro.json", "File to save recorded macros to and play them from")
+	chartFlag          = flag.Int("chartsecs", defaultChartSecs, "Number of seconds of telemetry shown in the charts")
 )
 
 var (
 	drone        tello.Tello
 	sticks       tello.StickMessage
-	joy          *sdl.Joystick
 	sportsMode   bool
 	wideVideo    bool
 	flightData   tello.FlightData
@@ -110,13 +147,6 @@ var (
 	flightDataMu sync.RWMutex
 )
 
-var (
-	bigFont, medFont, smallFont *ttf.Font
-	window                      *sdl.Window
-	surface                     *sdl.Surface
-	textColour                  = sdl.Color{R: 255, G: 128, B: 64, A: 255}
-)
-
 func printKeyHelp() {
 	fmt.Print(
 		`Tello Desktop Keyboard Control Mapping
@@ -133,6 +163,9 @@ B             Bounce (on/off)
 1|2|3|4       Flip Forwards/Backwards/Left/Right
 M             Mode - Toggle Sports(Fast) Mode
 V             Switch Video Mode
+I             Drone Information & Settings
+R             Start/Stop Recording a Macro
+G             Play the Macro (<SPACE> aborts)
 Q             Quit
 H             Print Help
 `)
@@ -150,10 +183,16 @@ Circle       Hover (stop all movement)
 Square       Take Photo
 L1           Bounce (on/off)
 L2           Palm Land
+Options      Menu (D-pad to choose, X to select, Options to go back)
+R1           Instructor takeover, held (trainer mode)
 `)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "logbook" {
+		runLogbook(os.Args[2:])
+		return
+	}
 	flag.Parse()
 	if *keyHelpFlag {
 		printKeyHelp()
@@ -163,6 +202,10 @@ func main() {
 		printJoystickHelp()
 		os.Exit(0)
 	}
+	if !haveWindow && !*tuiFlag {
+		fmt.Println("Built without SDL, using the terminal UI")
+		*tuiFlag = true
+	}
 
 	// catch termination signal
 	sigChan := make(chan os.Signal, 2)
@@ -172,20 +215,72 @@ func main() {
 		exitNicely()
 	}()
 
-	setupWindow()
-
-	j := sdl.NumJoysticks()
-	log.Printf("Number of Joysticks detected: %d\n", j)
-	if j > 0 {
-		joy = sdl.JoystickOpen(0)
-		if joy == nil {
-			log.Println("Error opening connection to joystick")
-			j = 0
-		} else {
-			log.Printf("Connected to joystick: %s\n", joy.Name())
+	if *chartFlag < 1 {
+		log.Fatalf("Chart duration must be at least 1 second, got %d", *chartFlag)
+	}
+	telemetry = newTelemetryRing(*chartFlag)
+
+	switch *reportFlag {
+	case "", "md", "html":
+	default:
+		log.Fatalf("Flight report format must be md or html, got %s", *reportFlag)
+	}
+
+	if *beginnerFlag {
+		if *beginnerSpdFlag < 1 || *beginnerSpdFlag > 100 {
+			log.Fatalf("Beginner speed must be 1 to 100%%, got %d", *beginnerSpdFlag)
+		}
+		if *beginnerHtFlag <= 0 || *beginnerTimeFlag < 0 {
+			log.Fatalf("Beginner height must be positive and flight time not negative")
+		}
+		startBeginnerMode(*beginnerSpdFlag, *beginnerHtFlag, time.Duration(*beginnerTimeFlag)*time.Second)
+	}
+
+	if *logbookFlag != "" {
+		label := *batteryFlag
+		// only interrupt the startup when the logbook was asked for, and never under the terminal UI
+		if label == "" && flagGiven("logbook") && !*tuiFlag {
+			label = askBatteryLabel()
+		}
+		if label != "" {
+			startBatteryTracking(*logbookFlag, label)
 		}
 	}
 
+	if *blackBoxFlag != "" {
+		if *blackBoxSecsFlag < 1 {
+			log.Fatalf("Black box duration must be at least 1 second, got %d", *blackBoxSecsFlag)
+		}
+		startBlackBox(*blackBoxFlag, *blackBoxSecsFlag)
+		defer blackBoxOnPanic()
+	}
+
+	if *audioFlag {
+		startAudio()
+	}
+
+	if *tuiFlag {
+		// anything logged to the terminal would corrupt the display
+		logFile, err := os.Create(tuiLogFile)
+		if err != nil {
+			log.Fatalf("Unable to create log file %s - %v", tuiLogFile, err)
+		}
+		log.SetOutput(logFile)
+		setupTui()
+	} else {
+		setupWindow()
+
+		if *trainerFlag {
+			if *studentLimitFlag < 1 || *studentLimitFlag > 100 {
+				log.Fatalf("Student stick limit must be 1 to 100%%, got %d", *studentLimitFlag)
+			}
+			if !startTrainer(*studentLimitFlag, *studentRateFlag) {
+				log.Fatalf("Unable to start trainer mode")
+			}
+		}
+		openJoystick()
+	}
+
 	err := drone.ControlConnectDefault()
 	if err != nil {
 		log.Fatalf("Tello ControlConnectDefault() failed with error %v", err)
@@ -196,40 +291,74 @@ func main() {
 		log.Fatalf("Tello VideoConnectDefault() failed with error %v", err)
 	}
 
-	// start external mplayer instance...
-	// the -vo X11 parm allows it to run nicely inside a virtual machine
-	// setting the FPS to 60 seems to produce smoother video
-	var player *exec.Cmd
-	if *x11Flag {
-		player = exec.Command("mplayer", "-nosound", "-vo", "x11", "-fps", "60", "-")
-	} else {
-		player = exec.Command("mplayer", "-nosound", "-fps", "60", "-")
+	// there is no display to play the video on in terminal mode
+	if !*tuiFlag {
+		if err = startPlayer(*x11Flag); err != nil {
+			log.Fatalf("Unable to start mplayer - %v", err)
+		}
 	}
 
-	playerIn, err := player.StdinPipe()
-	if err != nil {
-		log.Fatalf("Unable to get STDIN for mplayer %v", err)
+	if *recordFlag != "" {
+		if err = startRecorder(*recordFlag); err != nil {
+			log.Fatalf("Unable to start video recording - %v", err)
+		}
 	}
-	if err := player.Start(); err != nil {
-		log.Fatalf("Unable to start mplayer - %v", err)
-		return
+
+	if *mqttFlag != "" {
+		if err = startMQTT(*mqttFlag); err != nil {
+			log.Fatalf("Unable to connect to MQTT broker - %v", err)
+		}
 	}
 
+	if *mavlinkFlag != "" {
+		if err = startMAVLink(*mavlinkFlag); err != nil {
+			log.Fatalf("Unable to start MAVLink bridge - %v", err)
+		}
+	}
+
+	if *metricsFlag != "" {
+		startMetrics(*metricsFlag)
+	}
+
+	if *rtspFlag != "" {
+		if err = startRTSP(*rtspFlag); err != nil {
+			log.Fatalf("Unable to start RTSP server - %v", err)
+		}
+	}
+
+	if *mjpegFlag != "" {
+		if err = startMJPEG(*mjpegFlag); err != nil {
+			log.Fatalf("Unable to start MJPEG server - %v", err)
+		}
+	}
+
+	if *grpcFlag != "" {
+		if err = startGRPC(*grpcFlag); err != nil {
+			log.Fatalf("Unable to start gRPC server - %v", err)
+		}
+	}
+
+	startInspector()
+
 	// start video feed when drone connects
 	drone.StartVideo()
-	go func() {
-		for {
-			drone.StartVideo()
-			time.Sleep(time.Second)
-		}
-	}()
+	startKeyframeRequester()
 
 	go func() {
+		defer blackBoxOnPanic()
+		var splitter nalSplitter
+		var assembler auAssembler
 		for {
 			vbuf := <-videochan
-			_, err := playerIn.Write(vbuf)
-			if err != nil {
-				log.Fatalf("Error writing to mplayer %v\n", err)
+			videoBytes.Add(float64(len(vbuf)))
+			inspector.addBytes(len(vbuf))
+			for _, nal := range splitter.write(vbuf) {
+				noteParamSets(nal)
+				inspector.addNAL(nal)
+				if au := assembler.add(nal); au != nil {
+					videoFrames.Inc()
+					publishAccessUnit(au)
+				}
 			}
 		}
 	}()
@@ -237,135 +366,195 @@ func main() {
 	// subscribe to FlightData events and askfor updates every 50ms
 	fdChan, _ := drone.StreamFlightData(false, 50)
 	go func() {
+		defer blackBoxOnPanic()
 		for {
 			tmpFD := <-fdChan
+			flightDataPackets.Inc()
 			flightDataMu.Lock()
+			ev := detectFlightEvent(flightData, tmpFD)
+			prevFD := flightData
 			flightData = tmpFD
+			prevMsg := flightMsg
+			switch ev {
+			case takeOffEvent:
+				flightMsg = "Taking Off"
+			case landingEvent:
+				flightMsg = "Landing"
+			}
 			if flightData.BatteryLow {
 				flightMsg = "Battery Low"
 			}
 			if flightData.BatteryCritical {
 				flightMsg = "Battery Lower"
 			}
+			if flightMsg != prevMsg && (flightData.BatteryLow || flightData.BatteryCritical) {
+				addWarning(flightMsg)
+			}
+			if msg := trackBattery(tmpFD); msg != "" {
+				flightMsg = msg
+				addWarning(msg)
+			}
+			if msg := checkBeginner(ev, tmpFD); msg != "" {
+				flightMsg = msg
+			}
+			addTelemetrySample()
+			recordSession(ev, tmpFD)
+			recordFlightData(prevFD, tmpFD)
+			checkAudioCues(ev)
+			publishFlightData(ev, flightMsg != prevMsg)
 			flightDataMu.Unlock()
 		}
 	}()
 	log.Println("Checkpoint 1")
 
 	go func() {
+		defer blackBoxOnPanic()
 		for {
-			updateWindow()
+			if *tuiFlag {
+				updateTui()
+			} else {
+				updateWindow()
+			}
 			time.Sleep(winUpdatePeriod)
 		}
 	}()
 	log.Println("Checkpoint 1a")
 
-	drone.SetVideoBitrate(tello.Vbr4M)
+	level, auto, err := parseBitrate(*bitrateFlag)
+	if err != nil {
+		log.Fatalf("Bad -bitrate option - %v", err)
+	}
+	setVideoBitrate(level)
+	setBitrateAuto(auto)
 
 	drone.GetVersion()
 	drone.GetSSID()
 	drone.GetMaxHeight()
 
 	log.Println("Checkpoint 2")
-	sdlEventListener()
+	if *tuiFlag {
+		tuiEventListener()
+	} else {
+		sdlEventListener()
+	}
 	log.Println("Checkpoint 3")
 }
 
-func setupWindow() {
-	var err error
+// statusText holds the formatted flight status lines shared by the window and terminal UIs
+type statusText struct {
+	ht, gs, fs, ls, dstr, loc, bp, ftr, ws, vid, vbr, msg, mode string
+}
 
-	if err = sdl.Init(sdl.INIT_EVERYTHING); err != nil {
-		panic(err)
+// setFlightMsg shows a message in the status line from outside the flight data loop
+func setFlightMsg(msg string) {
+	flightDataMu.Lock()
+	if msg != flightMsg {
+		flightMsg = msg
+		publishMessage(msg)
 	}
-	if err = ttf.Init(); err != nil {
-		panic(err)
-	}
-	bigFont, err = ttf.OpenFont(fontPath, bigFontSize)
-	if err != nil {
-		log.Fatalf("Failed to open font %s due to %v", fontPath, err)
-	}
-	medFont, _ = ttf.OpenFont(fontPath, medFontSize)
-	smallFont, _ = ttf.OpenFont(fontPath, smallFontSize)
-	window, err = sdl.CreateWindow(winTitle, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, winWidth, winHeight, sdl.WINDOW_SHOWN)
-	if err != nil {
-		panic(err)
-	}
-	surface, err = window.GetSurface()
-	if err != nil {
-		panic(err)
-	}
-	surface.FillRect(nil, 0)
-	renderTextAt("Hello, Tello!", bigFont, 200, 200)
-	window.UpdateSurface()
+	flightDataMu.Unlock()
 }
 
-func updateWindow() {
-	surface.FillRect(nil, 0)
+// haveFlightData is false until we have heard from the drone, the flight data is all zero
+// until then and the battery is never reported as empty
+func haveFlightData(fd *tello.FlightData) bool {
+	return fd.BatteryPercentage != 0
+}
 
-	renderTextAt("Steve's Tello Desktop", bigFont, 155, 5)
-	renderTextAt(time.Now().Format(time.RFC1123), medFont, 150, 50)
-	flightDataMu.RLock()
-	if !drone.ControlConnected() {
-		renderTextAt("No flight data available", bigFont, 100, 200)
-		flightDataMu.RUnlock()
-	} else {
-		ht := fmt.Sprintf("Height: %.1fm", float32(flightData.Height)/10)
-		gs := fmt.Sprintf("Ground Speed:  %d m/s", flightData.GroundSpeed)
-		fs := fmt.Sprintf("Speeds - Fwd: %d m/s", flightData.NorthSpeed)
-		ls := fmt.Sprintf("Side: %d m/s", flightData.EastSpeed)
-		ds := math.Sqrt(float64(flightData.NorthSpeed*flightData.NorthSpeed) + float64(flightData.EastSpeed*flightData.EastSpeed))
-		dstr := fmt.Sprintf("Derived: %.1f m/s", ds)
-		loc := fmt.Sprintf("Flying: %c, Hover: %c, Ground: %c, Windy: %c",
-			boolToYN(flightData.Flying),
-			boolToYN(flightData.DroneHover),
-			boolToYN(flightData.OnGround),
-			boolToYN(flightData.WindState))
-		bp := fmt.Sprintf("Battery: %d%%  Over Temp: %c", flightData.BatteryPercentage, boolToYN(flightData.OverTemp))
-		ftr := fmt.Sprintf("Remaining - Flight Time: %ds, Battery: %d", flightData.DroneFlyTimeLeft, flightData.DroneFlyTimeLeft)
-		ws := fmt.Sprintf("WiFi - Strength: %d Interference: %d", flightData.WifiStrength, flightData.WifiInterference)
-		msg := flightMsg
-
-		flightDataMu.RUnlock()
-
-		// render the text outside of the data lock for best concurrency
-		renderTextAt(ht, bigFont, 220, 100)
-		renderTextAt(gs, medFont, 200, 140)
-		renderTextAt(fs, medFont, 20, 180)
-		renderTextAt(ls, medFont, 290, 180)
-		renderTextAt(dstr, medFont, 460, 180)
-		renderTextAt(loc, medFont, 20, 240)
-		renderTextAt(ws, medFont, 20, 360)
-		renderTextAt(bp, medFont, 20, 400)
-		renderTextAt(ftr, medFont, 20, 440)
-		if msg != "" {
-			renderTextAt(flightMsg, medFont, 20, 550)
-		}
-	}
+// speedMS converts a flight data speed, which is in decimetres per second, to metres per second
+func speedMS(dms int16) float64 {
+	return float64(dms) / 10
+}
 
-	window.UpdateSurface()
+// horizSpeedMS is the horizontal speed in metres per second derived from the north and east speeds
+func horizSpeedMS(fd *tello.FlightData) float64 {
+	return math.Hypot(speedMS(fd.NorthSpeed), speedMS(fd.EastSpeed))
 }
 
-func renderTextAt(what string, font *ttf.Font, x int32, y int32) {
-	render, err := font.RenderUTF8Solid(what, textColour)
-	if err != nil {
-		panic(err)
-	}
-	rect := &sdl.Rect{X: x, Y: y}
-	err = render.Blit(nil, surface, rect)
-	if err != nil {
-		panic(err)
-	}
+// getStatusText must be called with flightDataMu held
+func getStatusText() (st statusText) {
+	st.ht = fmt.Sprintf("Height: %.1fm", float32(flightData.Height)/10)
+	st.gs = fmt.Sprintf("Ground Speed:  %.1f m/s", speedMS(flightData.GroundSpeed))
+	st.fs = fmt.Sprintf("Speeds - Fwd: %.1f m/s", speedMS(flightData.NorthSpeed))
+	st.ls = fmt.Sprintf("Side: %.1f m/s", speedMS(flightData.EastSpeed))
+	st.dstr = fmt.Sprintf("Derived: %.1f m/s", horizSpeedMS(&flightData))
+	st.loc = fmt.Sprintf("Flying: %c, Hover: %c, Ground: %c, Windy: %c",
+		boolToYN(flightData.Flying),
+		boolToYN(flightData.DroneHover),
+		boolToYN(flightData.OnGround),
+		boolToYN(flightData.WindState))
+	st.bp = fmt.Sprintf("Battery: %d%%  Over Temp: %c", flightData.BatteryPercentage, boolToYN(flightData.OverTemp))
+	st.ftr = fmt.Sprintf("Remaining - Flight Time: %ds, Battery: %d", flightData.DroneFlyTimeLeft, flightData.DroneFlyTimeLeft)
+	st.ws = fmt.Sprintf("WiFi - Strength: %d Interference: %d", flightData.WifiStrength, flightData.WifiInterference)
+	st.vid = inspector.getStats().String()
+	st.vbr = bitrateText()
+	st.msg = flightMsg
+	st.mode = beginnerText()
+	return st
 }
 
 func exitNicely() {
+	if *tuiFlag {
+		// restore the terminal before printing anything
+		termbox.Close()
+	}
 	fmt.Printf("# pix in store: %d\n", drone.NumPics())
 	if drone.NumPics() > 0 {
-		drone.SaveAllPics(fmt.Sprintf("tello_pic_%s", time.Now().Format(time.RFC3339)))
+		prefix := fmt.Sprintf("tello_pic_%s", time.Now().Format(time.RFC3339))
+		drone.SaveAllPics(prefix)
+		addRecording(fmt.Sprintf("%d photos saved as %s*", drone.NumPics(), prefix))
+	}
+	writeReport(*reportFlag)
+	if *logbookFlag != "" {
+		saveLogbook(*logbookFlag)
+		saveBattery(*logbookFlag)
+	}
+	stopMQTT()
+	if !*tuiFlag {
+		closeWindow()
 	}
-	sdl.Quit()
 	os.Exit(0)
 }
 
+// flightEvent is a change of flying state detected from successive flight data updates
+type flightEvent int
+
+const (
+	noEvent flightEvent = iota
+	takeOffEvent
+	landingEvent
+)
+
+func (fe flightEvent) String() string {
+	switch fe {
+	case takeOffEvent:
+		return "takeoff"
+	case landingEvent:
+		return "landing"
+	}
+	return ""
+}
+
+func detectFlightEvent(prev, cur tello.FlightData) flightEvent {
+	switch {
+	case cur.Flying && !prev.Flying:
+		return takeOffEvent
+	case !cur.Flying && prev.Flying:
+		return landingEvent
+	}
+	return noEvent
+}
+
+// flagGiven reports whether the named flag was set on the command line
+func flagGiven(name string) (given bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
 func boolToYN(b bool) byte {
 	if b {
 		return 'Y'
@@ -373,125 +562,129 @@ func boolToYN(b bool) byte {
 	return 'N'
 }
 
-func sdlEventListener() {
-	var event sdl.Event
-	for {
-		event = sdl.WaitEvent()
-		switch event.(type) {
-		case *sdl.QuitEvent: // catch window closure
-			fmt.Println("Window Quit event")
-			exitNicely()
-
-		case *sdl.JoyAxisEvent:
-			handleJoyAxisEvent(event.(*sdl.JoyAxisEvent))
-
-		case *sdl.JoyButtonEvent:
-			// only send button presses for now
-			if event.(*sdl.JoyButtonEvent).Type == sdl.JOYBUTTONDOWN {
-				handleJoyButtonEvent(event.(*sdl.JoyButtonEvent))
-			}
+// commandIssued is called with every command carried out, whatever its source, and passes it on
+// to everything which follows the commands
+func commandIssued(source, command string) {
+	countCommand(source, command)
+	recordCommand(source, command)
+	recordMacroCommand(source, command)
+	switch command {
+	case "hover":
+		holdStudent()
+	case "photo":
+		addPhoto()
+	case "up", "down", "stop_up_down":
+		beginnerVertical()
+	}
+}
 
-		case *sdl.KeyboardEvent:
-			//fmt.Println("Keyboard Event")
-			// only send key presses for now
-			if event.(*sdl.KeyboardEvent).Type == sdl.KEYDOWN {
-				handleKeyDownEvent(event.(*sdl.KeyboardEvent).Keysym)
-			}
-		}
+// droneCommands are the commands which the keyboard, joystick, menu and macros all have by name
+var droneCommands = map[string]func(){
+	"takeoff":         drone.TakeOff,
+	"throw_takeoff":   drone.ThrowTakeOff,
+	"land":            drone.Land,
+	"palm_land":       drone.PalmLand,
+	"hover":           drone.Hover,
+	"bounce":          drone.Bounce,
+	"photo":           func() { drone.TakePicture() },
+	"left":            func() { drone.Left(capPct(25)) },
+	"right":           func() { drone.Right(capPct(25)) },
+	"forward":         func() { drone.Forward(capPct(25)) },
+	"backward":        func() { drone.Backward(capPct(25)) },
+	"up":              func() { drone.Up(capClimb(50)) },
+	"down":            func() { drone.Down(capPct(50)) },
+	"turn_left":       func() { drone.TurnLeft(capPct(50)) },
+	"turn_right":      func() { drone.TurnRight(capPct(50)) },
+	"stop_left_right": func() { drone.Left(0) },
+	"stop_fwd_back":   func() { drone.Forward(0) },
+	"stop_up_down":    func() { drone.Up(0) },
+	"stop_turn":       func() { drone.TurnLeft(0) },
+}
+
+// knownCommand is true for the drone commands and flips
+func knownCommand(command string) bool {
+	_, isCmd := droneCommands[command]
+	_, isFlip := flipCommands[command]
+	return isCmd || isFlip
+}
+
+// runCommand carries out one of the drone commands or flips, it returns false for any other command
+func runCommand(source, command string) bool {
+	if direction, ok := flipCommands[command]; ok {
+		uiFlip(source, direction)
+		return true
+	}
+	do, ok := droneCommands[command]
+	if !ok {
+		return false
 	}
+	commandIssued(source, command)
+	do()
+	return true
 }
 
-func handleKeyDownEvent(key sdl.Keysym) {
-	switch key.Sym {
-	case takeOffKey:
-		drone.TakeOff()
-	case landKey:
-		drone.Land()
-	case palmlandKey:
-		drone.PalmLand()
+func handleKeyDownEvent(key keyCode) {
+	if key == infoKey && !settingsEditingText() {
+		toggleSettings()
+		return
+	}
+	if key != panicKey && settingsOpen() {
+		settingsKeyDown(key)
+		return
+	}
+	if name, ok := keyCommandNames[key]; ok && !runCommand(keyboardSrc, name) {
+		// the rest are only counted
+		commandIssued(keyboardSrc, name)
+	}
+	switch key {
 	case panicKey:
-		drone.Hover()
-		drone.SetVideoBitrate(tello.Vbr3M)
+		setVideoBitrate(levelOf(tello.Vbr3M))
 		drone.GetVideoBitrate()
 		//drone.GetAttitude()
-	case bounceKey:
-		drone.Bounce()
-	case flipFwdKey:
-		drone.ForwardFlip()
-	case flipBkwdKey:
-		drone.BackFlip()
-	case flipLeftKey:
-		drone.LeftFlip()
-	case flipRightKey:
-		drone.RightFlip()
 	case modeKey:
-		sportsMode = !sportsMode
-		drone.SetSportsMode(sportsMode)
-	case moveLeftKey:
-		drone.Left(25)
-	case moveRightKey:
-		drone.Right(25)
-	case moveFwdKey:
-		drone.Forward(25)
-	case moveBkKey:
-		drone.Backward(25)
-	case moveUpKey:
-		drone.Up(50)
-	case moveDownKey:
-		drone.Down(50)
-	case takePhotoKey:
-		drone.TakePicture()
-	case throwKey:
-		drone.ThrowTakeOff()
-	case turnLeftKey:
-		drone.TurnLeft(50)
-	case turnRightKey:
-		drone.TurnRight(50)
+		toggleSportsMode()
 	case videoModeKey:
-		if wideVideo {
-			drone.SetVideoNormal()
-		} else {
-			drone.SetVideoWide()
-		}
-		wideVideo = !wideVideo
-	case quitKey, sdl.K_ESCAPE:
+		setVideoMode(!wideVideo)
+	case macroRecKey:
+		toggleMacroRecording(*macroFlag)
+	case macroPlayKey:
+		playMacro(*macroFlag)
+	case quitKey, keyEscape:
 		exitNicely()
 	case helpKey:
 		printKeyHelp()
 	}
 }
 
-func handleJoyAxisEvent(ev *sdl.JoyAxisEvent) {
-	switch ev.Axis {
+func setStickAxis(sm *tello.StickMessage, axis uint8, value int16) {
+	switch axis {
 	case turnLRAxis: // lx
-		sticks.Lx = ev.Value
+		sm.Lx = value
 	case moveUpDownAxis: // ly
-		sticks.Ly = -ev.Value
+		sm.Ly = -value
 	case 2: // l2
 	case moveLRAxis: // rx
-		sticks.Rx = ev.Value
+		sm.Rx = value
 	case moveFwdBkAxis: //
-		// log.Printf("Got js RY value: %d\n", ev.Value)
-		sticks.Ry = -ev.Value
+		// log.Printf("Got js RY value: %d\n", value)
+		sm.Ry = -value
 	case 5: // r2
 	}
-	drone.UpdateSticks(sticks)
 }
 
-func handleJoyButtonEvent(ev *sdl.JoyButtonEvent) {
-	switch ev.Button {
-	case landButton:
-		drone.Land()
-	case stopButton:
-		drone.Hover()
-	case takeOffButton:
-		drone.TakeOff()
-	case takePhotoButton:
-		drone.TakePicture()
-	case bounceButton:
-		drone.Bounce()
-	case palmLandButton:
-		drone.PalmLand()
-	}
+// updateSticks sends stick positions to the drone from any source
+func updateSticks(sm tello.StickMessage) {
+	recordMacroSticks(sm)
+	sm = capSticks(sm)
+	recordSticks(sm)
+	drone.UpdateSticks(sm)
+}
 
+func toggleSportsMode() {
+	if beginnerMode() {
+		setFlightMsg("No sports mode in beginner mode")
+		return
+	}
+	sportsMode = !sportsMode
+	drone.SetSportsMode(sportsMode)
 }
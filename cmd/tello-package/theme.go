@@ -0,0 +1,101 @@
+// theme.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nosdl
+// +build !nosdl
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// theme is the JSON colour configuration loaded via the -theme flag,
+// each colour is given as "#RRGGBB" and any that are omitted keep their default
+type theme struct {
+	Background string `json:"background"`
+	Text       string `json:"text"`
+	Hud        string `json:"hud"`
+	Sky        string `json:"sky"`
+	Ground     string `json:"ground"`
+	OK         string `json:"ok"`
+	Warn       string `json:"warn"`
+	Crit       string `json:"crit"`
+	Chart      string `json:"chart"`
+}
+
+var bgColour = sdl.Color{R: 0, G: 0, B: 0, A: 255}
+
+func loadTheme(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var th theme
+	if err = json.Unmarshal(buf, &th); err != nil {
+		return fmt.Errorf("cannot parse theme %s: %v", path, err)
+	}
+	for _, tc := range []struct {
+		hex    string
+		colour *sdl.Color
+	}{
+		{th.Background, &bgColour},
+		{th.Text, &textColour},
+		{th.Hud, &hudColour},
+		{th.Sky, &skyColour},
+		{th.Ground, &groundColour},
+		{th.OK, &okColour},
+		{th.Warn, &warnColour},
+		{th.Crit, &critColour},
+		{th.Chart, &chartColour},
+	} {
+		if tc.hex == "" {
+			continue
+		}
+		if *tc.colour, err = parseColour(tc.hex); err != nil {
+			return fmt.Errorf("bad colour in theme %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// parseColour converts a "#RRGGBB" string into an opaque colour
+func parseColour(hex string) (c sdl.Color, err error) {
+	if len(hex) != 7 {
+		err = fmt.Errorf("wrong length")
+	} else {
+		_, err = fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%q is not of the form #RRGGBB", hex)
+	}
+	c.A = 255
+	return c, nil
+}
+
+// bgPixel returns the background colour in the window surface's pixel format
+func bgPixel() uint32 {
+	return sdl.MapRGB(surface.Format, bgColour.R, bgColour.G, bgColour.B)
+}
@@ -0,0 +1,216 @@
+// trainer.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SMerrony/tello"
+)
+
+// In trainer mode two controllers are used: the first is the instructor's and the second the
+// student's.  The student flies until the instructor holds down the takeover button, at which
+// point the instructor's sticks are sent straight away; control returns to the student when
+// it is released.  The student's sticks can be limited to a fraction of their full range, and
+// in how quickly they can change.
+
+const (
+	takeoverButton     = 5 // R1, held by the instructor
+	studentSendPeriod  = 50 * time.Millisecond
+	stickFullScale     = 32767
+	stickCentred       = stickFullScale / 10 // student's sticks within this of the centre after a hover
+	instructorControls = "Control: INSTRUCTOR"
+	studentControls    = "Control: Student"
+)
+
+var (
+	trainerMu        sync.Mutex
+	trainerMode      bool
+	instructorJoy    int32
+	studentJoy       int32
+	instructorActive bool // the takeover button is held
+	instructorSticks tello.StickMessage
+	studentSticks    tello.StickMessage
+	studentSent      tello.StickMessage // after limiting
+	studentHeld      bool               // a hover has stopped the student until their sticks are centred
+	studentLimit     float64            // fraction of full deflection allowed
+	studentRate      float64            // full-scale deflections per second, 0 for no limit
+)
+
+// startTrainer opens both controllers, it returns false if there are not two of them
+func startTrainer(limitPct int, rate float64) bool {
+	ij, sj, ok := openTrainerJoysticks()
+	if !ok {
+		return false
+	}
+	trainerMu.Lock()
+	trainerMode = true
+	instructorJoy, studentJoy = ij, sj
+	studentLimit = float64(limitPct) / 100
+	studentRate = rate
+	trainerMu.Unlock()
+	go studentSender()
+	return true
+}
+
+func inTrainerMode() bool {
+	trainerMu.Lock()
+	defer trainerMu.Unlock()
+	return trainerMode
+}
+
+// controlText shows who is flying in trainer mode
+func controlText() string {
+	trainerMu.Lock()
+	defer trainerMu.Unlock()
+	switch {
+	case !trainerMode:
+		return ""
+	case instructorActive:
+		return instructorControls
+	}
+	return studentControls
+}
+
+// trainerAxis records a stick movement on either controller, the instructor's are sent at once
+func trainerAxis(which int32, axis uint8, value int16) {
+	trainerMu.Lock()
+	defer trainerMu.Unlock()
+	switch which {
+	case instructorJoy:
+		setStickAxis(&instructorSticks, axis, value)
+		if instructorActive {
+			updateSticks(instructorSticks)
+		}
+	case studentJoy:
+		setStickAxis(&studentSticks, axis, value)
+	}
+}
+
+// trainerButton decides whether a button press should be acted upon
+func trainerButton(which int32, button uint8, down bool) bool {
+	trainerMu.Lock()
+	defer trainerMu.Unlock()
+	if which == instructorJoy {
+		if button == takeoverButton {
+			setInstructorActive(down)
+			return false
+		}
+		return down
+	}
+	// the student may always hover
+	return down && (!instructorActive || button == stopButton)
+}
+
+// setInstructorActive must be called with trainerMu held
+func setInstructorActive(active bool) {
+	if active == instructorActive {
+		return
+	}
+	instructorActive = active
+	if active {
+		abortMacro()
+		updateSticks(instructorSticks)
+		log.Println("Instructor has taken control")
+		setFlightMsg("Instructor has control")
+	} else {
+		// the student starts from where the instructor left the sticks
+		studentSent = instructorSticks
+		log.Println("Student has control")
+		setFlightMsg("Student has control")
+	}
+}
+
+// remoteSticks passes on the sticks from gRPC and MAVLink clients, in trainer mode they are
+// ignored while the instructor has control
+func remoteSticks(sm tello.StickMessage) {
+	trainerMu.Lock()
+	defer trainerMu.Unlock()
+	if trainerMode && instructorActive {
+		return
+	}
+	updateSticks(sm)
+}
+
+// holdStudent is called for every hover, the student's sticks are ignored until they are centred
+// so that the hover is not immediately undone
+func holdStudent() {
+	trainerMu.Lock()
+	defer trainerMu.Unlock()
+	if trainerMode {
+		studentHeld = true
+		studentSent = tello.StickMessage{}
+	}
+}
+
+// studentSender sends the student's sticks whenever the limited value changes, so that rate limiting
+// reaches the stick position without overriding other controls while the student is not moving
+func studentSender() {
+	defer blackBoxOnPanic()
+	for range time.Tick(studentSendPeriod) {
+		trainerMu.Lock()
+		if studentHeld && sticksCentred(studentSticks) {
+			studentHeld = false
+		}
+		if !instructorActive && !studentHeld {
+			if next := limitStudent(studentSent, studentSticks); next != studentSent {
+				studentSent = next
+				updateSticks(studentSent)
+			}
+		}
+		trainerMu.Unlock()
+	}
+}
+
+func sticksCentred(sm tello.StickMessage) bool {
+	for _, v := range []int16{sm.Rx, sm.Ry, sm.Lx, sm.Ly} {
+		if v > stickCentred || v < -stickCentred {
+			return false
+		}
+	}
+	return true
+}
+
+// limitStudent scales the student's sticks to the permitted envelope and limits how fast they move
+func limitStudent(prev, want tello.StickMessage) tello.StickMessage {
+	maxStep := float64(stickFullScale)
+	if studentRate > 0 {
+		maxStep = studentRate * stickFullScale * studentSendPeriod.Seconds()
+	}
+	limit := func(p, w int16) int16 {
+		target := float64(w) * studentLimit
+		step := target - float64(p)
+		switch {
+		case step > maxStep:
+			step = maxStep
+		case step < -maxStep:
+			step = -maxStep
+		}
+		return int16(float64(p) + step)
+	}
+	return tello.StickMessage{
+		Rx: limit(prev.Rx, want.Rx), Ry: limit(prev.Ry, want.Ry),
+		Lx: limit(prev.Lx, want.Lx), Ly: limit(prev.Ly, want.Ly),
+	}
+}
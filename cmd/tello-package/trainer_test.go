@@ -0,0 +1,87 @@
+// trainer_test.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/SMerrony/tello"
+)
+
+func TestLimitStudent(t *testing.T) {
+	defer func(l, r float64) { studentLimit, studentRate = l, r }(studentLimit, studentRate)
+	full := tello.StickMessage{Rx: stickFullScale, Ry: -stickFullScale, Lx: 1000, Ly: 0}
+	tests := []struct {
+		name        string
+		limit, rate float64
+		prev, want  tello.StickMessage
+		expect      tello.StickMessage
+	}{
+		{"no limits", 1, 0, tello.StickMessage{}, full, full},
+		{"half deflection", 0.5, 0, tello.StickMessage{}, full,
+			tello.StickMessage{Rx: 16383, Ry: -16383, Lx: 500}},
+		// one full deflection per second allows a twentieth of full scale per 50ms
+		{"rate limited", 1, 1, tello.StickMessage{}, full,
+			tello.StickMessage{Rx: 1638, Ry: -1638, Lx: 1000}},
+		{"rate limited from prev", 1, 1, tello.StickMessage{Rx: 31500, Ry: 2000}, full,
+			tello.StickMessage{Rx: stickFullScale, Ry: 361, Lx: 1000}},
+		{"released", 1, 1, tello.StickMessage{Rx: 1000, Ly: -1000}, tello.StickMessage{},
+			tello.StickMessage{}},
+	}
+	for _, tc := range tests {
+		studentLimit, studentRate = tc.limit, tc.rate
+		if got := limitStudent(tc.prev, tc.want); got != tc.expect {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.expect)
+		}
+	}
+
+	// the student sender stops sending once the limited sticks reach the student's
+	studentLimit, studentRate = 0.8, 1
+	var sent tello.StickMessage
+	for i := 0; ; i++ {
+		next := limitStudent(sent, full)
+		if next == sent {
+			break
+		}
+		if i > 25 {
+			t.Fatalf("rate limited sticks did not settle, at %+v", sent)
+		}
+		sent = next
+	}
+}
+
+func TestSticksCentred(t *testing.T) {
+	tests := []struct {
+		sm   tello.StickMessage
+		want bool
+	}{
+		{tello.StickMessage{}, true},
+		{tello.StickMessage{Rx: stickCentred, Ly: -stickCentred}, true},
+		{tello.StickMessage{Lx: stickCentred + 1}, false},
+		{tello.StickMessage{Ry: -stickFullScale}, false},
+	}
+	for _, tc := range tests {
+		if got := sticksCentred(tc.sm); got != tc.want {
+			t.Errorf("sticksCentred(%+v) = %v, want %v", tc.sm, got, tc.want)
+		}
+	}
+}
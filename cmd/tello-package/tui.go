@@ -0,0 +1,270 @@
+// tui.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"time"
+	"unicode"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Terminals do not report key releases, so a movement is stopped when its key has not been
+// seen for this long.  It must be longer than the usual terminal auto-repeat delay.
+const tuiKeyReleaseDelay = 600 * time.Millisecond
+
+const (
+	tuiFg      = termbox.ColorYellow
+	tuiBg      = termbox.ColorDefault
+	tuiTitleFg = termbox.ColorCyan | termbox.AttrBold
+	tuiMsgFg   = termbox.ColorRed | termbox.AttrBold
+)
+
+// the terminal characters which map onto our keyboard controls
+var tuiRuneKeys = map[rune]keyCode{
+	'b': bounceKey,
+	'1': flipFwdKey,
+	'2': flipBkwdKey,
+	'3': flipLeftKey,
+	'4': flipRightKey,
+	'h': helpKey,
+	'l': landKey,
+	'm': modeKey,
+	's': moveDownKey,
+	'w': moveUpKey,
+	'p': palmlandKey,
+	'q': quitKey,
+	't': takeOffKey,
+	'f': takePhotoKey,
+	'o': throwKey,
+	'a': turnLeftKey,
+	'd': turnRightKey,
+	'v': videoModeKey,
+	'i': infoKey,
+	'r': macroRecKey,
+	'g': macroPlayKey,
+}
+
+var tuiSpecialKeys = map[termbox.Key]keyCode{
+	termbox.KeyArrowUp:    moveFwdKey,
+	termbox.KeyArrowDown:  moveBkKey,
+	termbox.KeyArrowLeft:  moveLeftKey,
+	termbox.KeyArrowRight: moveRightKey,
+	termbox.KeySpace:      panicKey,
+	termbox.KeyEsc:        keyEscape,
+}
+
+// extra keys used by the settings panel
+var tuiSettingsKeys = map[termbox.Key]keyCode{
+	termbox.KeyEnter:      keyReturn,
+	termbox.KeyBackspace:  keyBackspace,
+	termbox.KeyBackspace2: keyBackspace,
+}
+
+// tuiAxis identifies one stick axis for key-release emulation
+type tuiAxis int
+
+const (
+	tuiLRAxis tuiAxis = iota
+	tuiFwdBkAxis
+	tuiUpDownAxis
+	tuiTurnAxis
+)
+
+var (
+	tuiReleaseTimers = map[tuiAxis]*time.Timer{}
+	tuiShowHelp      bool // protected by flightDataMu
+)
+
+func setupTui() {
+	if err := termbox.Init(); err != nil {
+		panic(err)
+	}
+	termbox.Clear(tuiFg, tuiBg)
+	tuiPrintAt(0, 0, tuiTitleFg, "Hello, Tello!")
+	termbox.Flush()
+}
+
+func tuiPrintAt(x, y int, fg termbox.Attribute, what string) {
+	for _, r := range what {
+		termbox.SetCell(x, y, r, fg, tuiBg)
+		x++
+	}
+}
+
+// updateTui displays the same flight status as the SDL window
+func updateTui() {
+	termbox.Clear(tuiFg, tuiBg)
+	tuiPrintAt(0, 0, tuiTitleFg, "Steve's Tello Desktop")
+	tuiPrintAt(0, 1, tuiFg, time.Now().Format(time.RFC1123))
+	flightDataMu.RLock()
+	showHelp := tuiShowHelp
+	flightDataMu.RUnlock()
+	if showHelp {
+		tuiShowKeyHelp()
+		termbox.Flush()
+		return
+	}
+	if settingsOpen() {
+		for i, l := range settingsLines() {
+			tuiPrintAt(0, 3+i, tuiFg, l)
+		}
+		termbox.Flush()
+		return
+	}
+	flightDataMu.RLock()
+	if !drone.ControlConnected() {
+		flightDataMu.RUnlock()
+		tuiPrintAt(0, 3, tuiMsgFg, "No flight data available")
+	} else {
+		st := getStatusText()
+		flightDataMu.RUnlock()
+
+		tuiPrintAt(0, 3, tuiFg|termbox.AttrBold, st.ht)
+		tuiPrintAt(0, 4, tuiFg, st.gs)
+		tuiPrintAt(0, 5, tuiFg, st.fs+"  "+st.ls+"  "+st.dstr)
+		tuiPrintAt(0, 6, tuiFg, st.loc)
+		tuiPrintAt(0, 7, tuiMsgFg, st.mode)
+		tuiPrintAt(0, 8, tuiFg, st.ws)
+		tuiPrintAt(0, 9, tuiFg, st.bp)
+		tuiPrintAt(0, 10, tuiFg, st.ftr)
+		tuiPrintAt(0, 11, tuiFg, st.vid+"  "+st.vbr)
+		if st.msg != "" {
+			tuiPrintAt(0, 12, tuiMsgFg, st.msg)
+		}
+	}
+	tuiPrintAt(0, 14, tuiTitleFg, "H: Help  Q: Quit")
+	termbox.Flush()
+}
+
+func tuiShowKeyHelp() {
+	lines := []string{
+		"<Cursor Keys> Move Left/Right/Forward/Backward",
+		"W|A|S|D       W: Up, S: Down, A: Turn Left, D: Turn Right",
+		"<SPACE>       Hover (stop all movement)",
+		"T             Takeoff",
+		"O             Throw Takeoff",
+		"L             Land",
+		"P             Palm Land",
+		"F             Take Picture (Foto)",
+		"B             Bounce (on/off)",
+		"1|2|3|4       Flip Forwards/Backwards/Left/Right",
+		"M             Mode - Toggle Sports(Fast) Mode",
+		"V             Switch Video Mode",
+		"I             Drone Information & Settings",
+		"R             Start/Stop Recording a Macro",
+		"G             Play the Macro (<SPACE> aborts)",
+		"Q             Quit",
+		"H             Hide Help",
+	}
+	for i, l := range lines {
+		tuiPrintAt(0, 3+i, tuiFg, l)
+	}
+}
+
+func tuiEventListener() {
+	for {
+		ev := termbox.PollEvent()
+		switch ev.Type {
+		case termbox.EventKey:
+			if ev.Key == termbox.KeyCtrlC {
+				exitNicely()
+			}
+			if settingsOpen() {
+				tuiSettingsEvent(ev)
+				continue
+			}
+			var key keyCode
+			var ok bool
+			if ev.Ch != 0 {
+				key, ok = tuiRuneKeys[unicode.ToLower(ev.Ch)]
+			} else {
+				key, ok = tuiSpecialKeys[ev.Key]
+			}
+			if !ok {
+				continue
+			}
+			if key == helpKey {
+				// printing the help would corrupt the terminal display
+				flightDataMu.Lock()
+				tuiShowHelp = !tuiShowHelp
+				flightDataMu.Unlock()
+				continue
+			}
+			handleKeyDownEvent(key)
+			tuiArmKeyRelease(key)
+		case termbox.EventError:
+			panic(ev.Err)
+		}
+	}
+}
+
+// tuiSettingsEvent passes keys to the settings panel, or the panic key to the drone
+func tuiSettingsEvent(ev termbox.Event) {
+	if ev.Ch != 0 && settingsTyped(string(ev.Ch)) {
+		return
+	}
+	var key keyCode
+	var ok bool
+	switch {
+	case ev.Ch == 'y' || ev.Ch == 'Y':
+		key, ok = 'y', true
+	case ev.Ch == 'n' || ev.Ch == 'N':
+		key, ok = 'n', true
+	case ev.Ch != 0:
+		key, ok = tuiRuneKeys[unicode.ToLower(ev.Ch)]
+	default:
+		if key, ok = tuiSettingsKeys[ev.Key]; !ok {
+			key, ok = tuiSpecialKeys[ev.Key]
+		}
+	}
+	if ok {
+		handleKeyDownEvent(key)
+	}
+}
+
+// tuiArmKeyRelease (re)starts the timer which stops a movement when its key is no longer repeating
+func tuiArmKeyRelease(key keyCode) {
+	var axis tuiAxis
+	var release func()
+	switch key {
+	case moveLeftKey, moveRightKey:
+		axis, release = tuiLRAxis, func() { tuiStop("stop_left_right") }
+	case moveFwdKey, moveBkKey:
+		axis, release = tuiFwdBkAxis, func() { tuiStop("stop_fwd_back") }
+	case moveUpKey, moveDownKey:
+		axis, release = tuiUpDownAxis, func() { tuiStop("stop_up_down") }
+	case turnLeftKey, turnRightKey:
+		axis, release = tuiTurnAxis, func() { tuiStop("stop_turn") }
+	default:
+		return
+	}
+	if t, found := tuiReleaseTimers[axis]; found {
+		t.Stop()
+	}
+	tuiReleaseTimers[axis] = time.AfterFunc(tuiKeyReleaseDelay, release)
+}
+
+// tuiStop stops movement on one axis when its key is released, as a command so that macros include it
+func tuiStop(command string) {
+	runCommand(keyboardSrc, command)
+}
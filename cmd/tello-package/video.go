@@ -0,0 +1,249 @@
+// video.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"sync"
+	"time"
+)
+
+// The video bus passes complete frames from the drone to any number of consumers (the player,
+// recorders and network streamers).  Each has its own bounded queue so that a slow consumer
+// can never hold up the others, or the drone.  A consumer that falls behind has frames dropped
+// until the next keyframe, as anything else would only give it a corrupt picture.
+// If the resolution changes the bus closes every consumer's channel so that they can
+// reinitialise, consumers that want to carry on simply subscribe again.
+//
+// The Tello only sends a keyframe, with its SPS and PPS, when asked, so one is requested
+// whenever a consumer joins or the stream is damaged, and again until it arrives.
+
+const (
+	videoQueueLen  = 30
+	keyframeRetry  = time.Second
+	keyframeMinGap = 200 * time.Millisecond
+)
+
+// videoSub is one consumer of the video bus
+type videoSub struct {
+	name    string
+	frames  chan []byte
+	waiting bool // for a keyframe, after joining or falling behind
+	wantKey bool // a keyframe is wanted soon, but frames are still being taken
+}
+
+var (
+	videoSubsMu sync.Mutex
+	videoSubs   = map[*videoSub]bool{}
+	syncLost    bool // frames have been lost since the last keyframe
+
+	keyframeReq = make(chan struct{}, 1)
+
+	// the most recent parameter sets, for consumers that join mid-stream
+	paramSetsMu sync.RWMutex
+	lastSPS     []byte
+	lastPPS     []byte
+)
+
+// subscribeVideo adds a consumer, its first frame will be the next keyframe
+func subscribeVideo(name string) *videoSub {
+	vs := &videoSub{name: name, frames: make(chan []byte, videoQueueLen), waiting: true}
+	videoSubsMu.Lock()
+	videoSubs[vs] = true
+	videoSubsMu.Unlock()
+	log.Printf("Video consumer %s subscribed\n", name)
+	requestKeyframe()
+	return vs
+}
+
+// unsubscribeVideo must be called by a consumer when it stops for any reason
+func unsubscribeVideo(vs *videoSub) {
+	videoSubsMu.Lock()
+	delete(videoSubs, vs)
+	videoSubsMu.Unlock()
+	log.Printf("Video consumer %s unsubscribed\n", vs.name)
+}
+
+// publishAccessUnit passes a complete frame to every consumer that is keeping up
+func publishAccessUnit(au []byte) {
+	isKey := containsIDR(au)
+	var withParams []byte
+	videoSubsMu.Lock()
+	defer videoSubsMu.Unlock()
+	if isKey {
+		syncLost = false
+	}
+	for vs := range videoSubs {
+		frame := au
+		if isKey {
+			vs.wantKey = false
+		}
+		if vs.waiting {
+			if !isKey {
+				videoDropped.WithLabelValues(vs.name).Inc()
+				continue
+			}
+			// send the parameter sets too so that the consumer can (re)start decoding immediately
+			if withParams == nil {
+				sps, pps := getParamSets()
+				withParams = append(append(append([]byte{}, sps...), pps...), au...)
+			}
+			frame = withParams
+		}
+		select {
+		case vs.frames <- frame:
+			vs.waiting = false
+		default:
+			if !vs.waiting {
+				log.Printf("Video consumer %s is falling behind, dropping to next keyframe\n", vs.name)
+			}
+			vs.waiting = true
+			videoDropped.WithLabelValues(vs.name).Inc()
+		}
+	}
+}
+
+// restartVideoConsumers closes every consumer's channel, they will have to subscribe again
+func restartVideoConsumers() {
+	videoSubsMu.Lock()
+	defer videoSubsMu.Unlock()
+	for vs := range videoSubs {
+		delete(videoSubs, vs)
+		close(vs.frames)
+	}
+}
+
+// lostSync is called when the stream is known to be damaged, decoders will not recover until a keyframe
+func lostSync() {
+	videoSubsMu.Lock()
+	syncLost = true
+	videoSubsMu.Unlock()
+	requestKeyframe()
+}
+
+// wantKeyframe is called by a consumer that needs a keyframe soon without dropping the frames before it
+func (vs *videoSub) wantKeyframe() {
+	videoSubsMu.Lock()
+	vs.wantKey = true
+	videoSubsMu.Unlock()
+	requestKeyframe()
+}
+
+// requestKeyframe asks the keyframe requester to ask the drone for a keyframe soon, it never blocks
+func requestKeyframe() {
+	select {
+	case keyframeReq <- struct{}{}:
+	default:
+	}
+}
+
+// needKeyframe is true until we have the parameter sets, a keyframe has been received since
+// the stream was damaged, and every consumer has started and has had any keyframe it asked for
+func needKeyframe() bool {
+	if sps, pps := getParamSets(); sps == nil || pps == nil {
+		return true
+	}
+	videoSubsMu.Lock()
+	defer videoSubsMu.Unlock()
+	if syncLost {
+		return true
+	}
+	for vs := range videoSubs {
+		if vs.waiting || vs.wantKey {
+			return true
+		}
+	}
+	return false
+}
+
+// startKeyframeRequester replaces blindly asking for the video to start every second
+func startKeyframeRequester() {
+	go func() {
+		defer blackBoxOnPanic()
+		var lastRequest time.Time
+		retry := time.NewTicker(keyframeRetry)
+		for {
+			select {
+			case <-keyframeReq:
+			case <-retry.C:
+			}
+			if time.Since(lastRequest) < keyframeMinGap || !needKeyframe() {
+				continue
+			}
+			drone.StartVideo()
+			keyframeRequests.Inc()
+			lastRequest = time.Now()
+		}
+	}()
+}
+
+// setVideoMode switches between the normal (4:3) and wide (16:9) video modes,
+// the consumers are restarted when the new resolution arrives
+func setVideoMode(wide bool) {
+	if wide {
+		drone.SetVideoWide()
+	} else {
+		drone.SetVideoNormal()
+	}
+	wideVideo = wide
+	requestKeyframe()
+}
+
+// noteParamSets remembers the NAL unit if it is an SPS or PPS
+func noteParamSets(nal []byte) {
+	switch nalType(nal) {
+	case nalSPS:
+		paramSetsMu.Lock()
+		prev := lastSPS
+		lastSPS = nal
+		paramSetsMu.Unlock()
+		if prev != nil && !bytes.Equal(prev, nal) && resolutionChanged(prev, nal) {
+			log.Println("Video resolution changed, restarting consumers")
+			restartVideoConsumers()
+		}
+	case nalPPS:
+		paramSetsMu.Lock()
+		lastPPS = nal
+		paramSetsMu.Unlock()
+	}
+}
+
+// getParamSets returns the latest SPS and PPS (with start codes), either may be nil
+func getParamSets() (sps, pps []byte) {
+	paramSetsMu.RLock()
+	defer paramSetsMu.RUnlock()
+	return lastSPS, lastPPS
+}
+
+// resolutionChanged compares two SPS NAL units (with start codes)
+func resolutionChanged(prev, cur []byte) bool {
+	p, err := parseSPS(prev[nalHeaderOffset(prev):])
+	if err != nil {
+		return true
+	}
+	c, err := parseSPS(cur[nalHeaderOffset(cur):])
+	if err != nil {
+		return false // wait for a good one
+	}
+	return p.width != c.width || p.height != c.height
+}
@@ -0,0 +1,271 @@
+// window.go
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !nosdl
+// +build !nosdl
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+
+	"github.com/SMerrony/tello-desktop/assets"
+)
+
+// The SDL front end: the status window, keyboard, and controllers.
+// Build with -tags nosdl for a terminal-only program which does not need the SDL libraries.
+
+const haveWindow = true
+
+var (
+	bigFont, medFont, smallFont *ttf.Font
+	window                      *sdl.Window
+	surface                     *sdl.Surface
+	textColour                  = sdl.Color{R: 255, G: 128, B: 64, A: 255}
+	joy                         *sdl.Joystick
+)
+
+func setupWindow() {
+	var err error
+
+	if err = sdl.Init(sdl.INIT_EVERYTHING); err != nil {
+		panic(err)
+	}
+	if err = ttf.Init(); err != nil {
+		panic(err)
+	}
+	if *themeFlag != "" {
+		if err = loadTheme(*themeFlag); err != nil {
+			log.Fatalf("Failed to load theme due to %v", err)
+		}
+	}
+	bigFont, err = openFont(bigFontSize)
+	if err != nil {
+		log.Fatalf("Failed to open font due to %v", err)
+	}
+	medFont, _ = openFont(medFontSize)
+	smallFont, _ = openFont(smallFontSize)
+	window, err = sdl.CreateWindow(winTitle, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, winWidth, winHeight, sdl.WINDOW_SHOWN)
+	if err != nil {
+		panic(err)
+	}
+	surface, err = window.GetSurface()
+	if err != nil {
+		panic(err)
+	}
+	renderer, err = sdl.CreateSoftwareRenderer(surface)
+	if err != nil {
+		panic(err)
+	}
+	surface.FillRect(nil, bgPixel())
+	renderTextAt("Hello, Tello!", bigFont, 200, 200)
+	window.UpdateSurface()
+}
+
+// openFont loads the font given by the -font flag, or the built-in one if that is not set
+func openFont(size int) (*ttf.Font, error) {
+	if *fontFlag != "" {
+		return ttf.OpenFont(*fontFlag, size)
+	}
+	rw, err := sdl.RWFromMem(assets.Font)
+	if err != nil {
+		return nil, err
+	}
+	// the RWops is freed when the font is closed
+	return ttf.OpenFontRW(rw, 1, size)
+}
+
+func updateWindow() {
+	surface.FillRect(nil, bgPixel())
+
+	renderTextAt("Steve's Tello Desktop", bigFont, 155, 5)
+	renderTextAt(time.Now().Format(time.RFC1123), medFont, 150, 50)
+	flightDataMu.RLock()
+	if !drone.ControlConnected() {
+		renderTextAt("No flight data available", bigFont, 100, 200)
+		flightDataMu.RUnlock()
+	} else {
+		st := getStatusText()
+		hd := getHudData()
+
+		flightDataMu.RUnlock()
+		ct := controlText()
+
+		// render the text outside of the data lock for best concurrency
+		if settingsOpen() {
+			for i, l := range settingsLines() {
+				if l != "" {
+					renderTextAt(l, medFont, 20, int32(100+i*settingsLineHeight))
+				}
+			}
+		} else {
+			renderTextAt(st.ht, bigFont, 220, 100)
+			renderTextAt(st.gs, medFont, 200, 140)
+			renderTextAt(st.fs, medFont, 20, 180)
+			renderTextAt(st.ls, medFont, 290, 180)
+			renderTextAt(st.dstr, medFont, 460, 180)
+			renderTextAt(st.loc, medFont, 20, 240)
+			renderTextAt(st.ws, medFont, 20, 360)
+			renderTextAt(st.bp, medFont, 20, 400)
+			renderTextAt(st.ftr, medFont, 20, 440)
+			renderTextAt(st.vid, smallFont, 20, 490)
+			renderTextAt(st.vbr, smallFont, 20, 510)
+			if ct != "" {
+				renderTextAt(ct, medFont, 20, 300)
+			}
+			if st.mode != "" {
+				renderTextAt(st.mode, medFont, 20, 330)
+			}
+		}
+		if st.msg != "" {
+			renderTextAt(st.msg, medFont, 20, 550)
+		}
+		drawHud(hd)
+		drawCharts()
+	}
+	drawMenu()
+
+	window.UpdateSurface()
+}
+
+func renderTextAt(what string, font *ttf.Font, x int32, y int32) {
+	render, err := font.RenderUTF8Solid(what, textColour)
+	if err != nil {
+		panic(err)
+	}
+	rect := &sdl.Rect{X: x, Y: y}
+	err = render.Blit(nil, surface, rect)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// sdlKeys are the SDL keys which do not map onto keyCodes by their character
+var sdlKeys = map[sdl.Keycode]keyCode{
+	sdl.K_UP:    keyUp,
+	sdl.K_DOWN:  keyDown,
+	sdl.K_LEFT:  keyLeft,
+	sdl.K_RIGHT: keyRight,
+}
+
+func sdlKey(k sdl.Keycode) keyCode {
+	if key, ok := sdlKeys[k]; ok {
+		return key
+	}
+	return keyCode(k)
+}
+
+// openJoystick connects to the first controller, if there is one and it is not in use by trainer mode
+func openJoystick() {
+	j := sdl.NumJoysticks()
+	log.Printf("Number of Joysticks detected: %d\n", j)
+	if j > 0 && !*trainerFlag {
+		joy = sdl.JoystickOpen(0)
+		if joy == nil {
+			log.Println("Error opening connection to joystick")
+		} else {
+			log.Printf("Connected to joystick: %s\n", joy.Name())
+		}
+	}
+}
+
+// openTrainerJoysticks opens the instructor's and student's controllers
+func openTrainerJoysticks() (instructor, student int32, ok bool) {
+	if sdl.NumJoysticks() < 2 {
+		log.Println("Trainer mode needs two controllers")
+		return 0, 0, false
+	}
+	ij, sj := sdl.JoystickOpen(0), sdl.JoystickOpen(1)
+	if ij == nil || sj == nil {
+		log.Println("Error opening connection to trainer mode controllers")
+		return 0, 0, false
+	}
+	log.Printf("Trainer mode - instructor: %s, student: %s\n", ij.Name(), sj.Name())
+	joy = ij
+	return int32(ij.InstanceID()), int32(sj.InstanceID()), true
+}
+
+func startTextInput() { sdl.StartTextInput() }
+func stopTextInput()  { sdl.StopTextInput() }
+
+func closeWindow() {
+	sdl.Quit()
+}
+
+func sdlEventListener() {
+	var event sdl.Event
+	for {
+		event = sdl.WaitEvent()
+		switch event.(type) {
+		case *sdl.QuitEvent: // catch window closure
+			fmt.Println("Window Quit event")
+			exitNicely()
+
+		case *sdl.JoyAxisEvent:
+			handleJoyAxisEvent(event.(*sdl.JoyAxisEvent))
+
+		case *sdl.JoyHatEvent:
+			handleJoyHatEvent(event.(*sdl.JoyHatEvent))
+
+		case *sdl.JoyButtonEvent:
+			if ev := event.(*sdl.JoyButtonEvent); inTrainerMode() && !trainerButton(int32(ev.Which), ev.Button, ev.Type == sdl.JOYBUTTONDOWN) {
+				continue
+			}
+			// only send button presses for now
+			if event.(*sdl.JoyButtonEvent).Type == sdl.JOYBUTTONDOWN {
+				handleJoyButtonEvent(event.(*sdl.JoyButtonEvent))
+			}
+
+		case *sdl.TextInputEvent:
+			settingsTyped(event.(*sdl.TextInputEvent).GetText())
+
+		case *sdl.KeyboardEvent:
+			//fmt.Println("Keyboard Event")
+			// only send key presses for now
+			if event.(*sdl.KeyboardEvent).Type == sdl.KEYDOWN {
+				handleKeyDownEvent(sdlKey(event.(*sdl.KeyboardEvent).Keysym.Sym))
+			}
+		}
+	}
+}
+
+func handleJoyAxisEvent(ev *sdl.JoyAxisEvent) {
+	if inTrainerMode() {
+		trainerAxis(int32(ev.Which), ev.Axis, ev.Value)
+		return
+	}
+	setStickAxis(&sticks, ev.Axis, ev.Value)
+	updateSticks(sticks)
+}
+
+func handleJoyButtonEvent(ev *sdl.JoyButtonEvent) {
+	if menuButtonEvent(ev.Button) {
+		return
+	}
+	if name, ok := buttonCommandNames[ev.Button]; ok {
+		runCommand(joystickSrc, name)
+	}
+}
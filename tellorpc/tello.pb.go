@@ -0,0 +1,871 @@
+// tello.proto
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// The gRPC API served by tello-desktop when it is started with the -grpc flag.
+// After changing this file regenerate the Go code with "go generate" in this directory.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: tello.proto
+
+package tellorpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Empty is used where a call needs no arguments.
+type Empty struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	mi := &file_tello_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{0}
+}
+
+// CommandReply is returned by all the discrete commands.
+type CommandReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"` // why the command was refused
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandReply) Reset() {
+	*x = CommandReply{}
+	mi := &file_tello_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandReply) ProtoMessage() {}
+
+func (x *CommandReply) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandReply.ProtoReflect.Descriptor instead.
+func (*CommandReply) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CommandReply) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *CommandReply) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// FlipRequest asks for a flip in one of the directions "forward", "backward", "left" or "right".
+type FlipRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Direction     string                 `protobuf:"bytes,1,opt,name=direction,proto3" json:"direction,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlipRequest) Reset() {
+	*x = FlipRequest{}
+	mi := &file_tello_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlipRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlipRequest) ProtoMessage() {}
+
+func (x *FlipRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlipRequest.ProtoReflect.Descriptor instead.
+func (*FlipRequest) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FlipRequest) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+// VideoModeRequest selects wide (16:9) or normal (4:3) video.
+type VideoModeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Wide          bool                   `protobuf:"varint,1,opt,name=wide,proto3" json:"wide,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VideoModeRequest) Reset() {
+	*x = VideoModeRequest{}
+	mi := &file_tello_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VideoModeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VideoModeRequest) ProtoMessage() {}
+
+func (x *VideoModeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VideoModeRequest.ProtoReflect.Descriptor instead.
+func (*VideoModeRequest) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VideoModeRequest) GetWide() bool {
+	if x != nil {
+		return x.Wide
+	}
+	return false
+}
+
+// FlightDataRequest sets how often flight data is streamed, the minimum is 50ms.
+type FlightDataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PeriodMs      int32                  `protobuf:"varint,1,opt,name=period_ms,json=periodMs,proto3" json:"period_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlightDataRequest) Reset() {
+	*x = FlightDataRequest{}
+	mi := &file_tello_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlightDataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlightDataRequest) ProtoMessage() {}
+
+func (x *FlightDataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlightDataRequest.ProtoReflect.Descriptor instead.
+func (*FlightDataRequest) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FlightDataRequest) GetPeriodMs() int32 {
+	if x != nil {
+		return x.PeriodMs
+	}
+	return 0
+}
+
+// FlightData is one timestamped flight data update, the values are as reported by the Tello.
+type FlightData struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Time              *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Flying            bool                   `protobuf:"varint,2,opt,name=flying,proto3" json:"flying,omitempty"`
+	OnGround          bool                   `protobuf:"varint,3,opt,name=on_ground,json=onGround,proto3" json:"on_ground,omitempty"`
+	DroneHover        bool                   `protobuf:"varint,4,opt,name=drone_hover,json=droneHover,proto3" json:"drone_hover,omitempty"`
+	EmOpen            bool                   `protobuf:"varint,5,opt,name=em_open,json=emOpen,proto3" json:"em_open,omitempty"`
+	Height            int32                  `protobuf:"varint,6,opt,name=height,proto3" json:"height,omitempty"` // decimetres
+	BatteryPercentage int32                  `protobuf:"varint,7,opt,name=battery_percentage,json=batteryPercentage,proto3" json:"battery_percentage,omitempty"`
+	BatteryLow        bool                   `protobuf:"varint,8,opt,name=battery_low,json=batteryLow,proto3" json:"battery_low,omitempty"`
+	BatteryCritical   bool                   `protobuf:"varint,9,opt,name=battery_critical,json=batteryCritical,proto3" json:"battery_critical,omitempty"`
+	BatteryMilliVolts int32                  `protobuf:"varint,10,opt,name=battery_milli_volts,json=batteryMilliVolts,proto3" json:"battery_milli_volts,omitempty"`
+	FlyTime           int32                  `protobuf:"varint,11,opt,name=fly_time,json=flyTime,proto3" json:"fly_time,omitempty"`
+	DroneFlyTimeLeft  int32                  `protobuf:"varint,12,opt,name=drone_fly_time_left,json=droneFlyTimeLeft,proto3" json:"drone_fly_time_left,omitempty"`
+	NorthSpeed        int32                  `protobuf:"varint,13,opt,name=north_speed,json=northSpeed,proto3" json:"north_speed,omitempty"`
+	EastSpeed         int32                  `protobuf:"varint,14,opt,name=east_speed,json=eastSpeed,proto3" json:"east_speed,omitempty"`
+	VerticalSpeed     int32                  `protobuf:"varint,15,opt,name=vertical_speed,json=verticalSpeed,proto3" json:"vertical_speed,omitempty"`
+	GroundSpeed       int32                  `protobuf:"varint,16,opt,name=ground_speed,json=groundSpeed,proto3" json:"ground_speed,omitempty"`
+	WifiStrength      uint32                 `protobuf:"varint,17,opt,name=wifi_strength,json=wifiStrength,proto3" json:"wifi_strength,omitempty"`
+	WifiInterference  uint32                 `protobuf:"varint,18,opt,name=wifi_interference,json=wifiInterference,proto3" json:"wifi_interference,omitempty"`
+	LightStrength     uint32                 `protobuf:"varint,19,opt,name=light_strength,json=lightStrength,proto3" json:"light_strength,omitempty"`
+	OverTemp          bool                   `protobuf:"varint,20,opt,name=over_temp,json=overTemp,proto3" json:"over_temp,omitempty"`
+	FlyMode           uint32                 `protobuf:"varint,21,opt,name=fly_mode,json=flyMode,proto3" json:"fly_mode,omitempty"`
+	MaxHeight         uint32                 `protobuf:"varint,22,opt,name=max_height,json=maxHeight,proto3" json:"max_height,omitempty"` // metres
+	Ssid              string                 `protobuf:"bytes,23,opt,name=ssid,proto3" json:"ssid,omitempty"`
+	Version           string                 `protobuf:"bytes,24,opt,name=version,proto3" json:"version,omitempty"`
+	Pitch             int32                  `protobuf:"varint,25,opt,name=pitch,proto3" json:"pitch,omitempty"` // degrees
+	Roll              int32                  `protobuf:"varint,26,opt,name=roll,proto3" json:"roll,omitempty"`
+	Yaw               int32                  `protobuf:"varint,27,opt,name=yaw,proto3" json:"yaw,omitempty"`
+	PositionX         float32                `protobuf:"fixed32,28,opt,name=position_x,json=positionX,proto3" json:"position_x,omitempty"` // from the visual positioning system
+	PositionY         float32                `protobuf:"fixed32,29,opt,name=position_y,json=positionY,proto3" json:"position_y,omitempty"`
+	PositionZ         float32                `protobuf:"fixed32,30,opt,name=position_z,json=positionZ,proto3" json:"position_z,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *FlightData) Reset() {
+	*x = FlightData{}
+	mi := &file_tello_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlightData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlightData) ProtoMessage() {}
+
+func (x *FlightData) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlightData.ProtoReflect.Descriptor instead.
+func (*FlightData) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FlightData) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *FlightData) GetFlying() bool {
+	if x != nil {
+		return x.Flying
+	}
+	return false
+}
+
+func (x *FlightData) GetOnGround() bool {
+	if x != nil {
+		return x.OnGround
+	}
+	return false
+}
+
+func (x *FlightData) GetDroneHover() bool {
+	if x != nil {
+		return x.DroneHover
+	}
+	return false
+}
+
+func (x *FlightData) GetEmOpen() bool {
+	if x != nil {
+		return x.EmOpen
+	}
+	return false
+}
+
+func (x *FlightData) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *FlightData) GetBatteryPercentage() int32 {
+	if x != nil {
+		return x.BatteryPercentage
+	}
+	return 0
+}
+
+func (x *FlightData) GetBatteryLow() bool {
+	if x != nil {
+		return x.BatteryLow
+	}
+	return false
+}
+
+func (x *FlightData) GetBatteryCritical() bool {
+	if x != nil {
+		return x.BatteryCritical
+	}
+	return false
+}
+
+func (x *FlightData) GetBatteryMilliVolts() int32 {
+	if x != nil {
+		return x.BatteryMilliVolts
+	}
+	return 0
+}
+
+func (x *FlightData) GetFlyTime() int32 {
+	if x != nil {
+		return x.FlyTime
+	}
+	return 0
+}
+
+func (x *FlightData) GetDroneFlyTimeLeft() int32 {
+	if x != nil {
+		return x.DroneFlyTimeLeft
+	}
+	return 0
+}
+
+func (x *FlightData) GetNorthSpeed() int32 {
+	if x != nil {
+		return x.NorthSpeed
+	}
+	return 0
+}
+
+func (x *FlightData) GetEastSpeed() int32 {
+	if x != nil {
+		return x.EastSpeed
+	}
+	return 0
+}
+
+func (x *FlightData) GetVerticalSpeed() int32 {
+	if x != nil {
+		return x.VerticalSpeed
+	}
+	return 0
+}
+
+func (x *FlightData) GetGroundSpeed() int32 {
+	if x != nil {
+		return x.GroundSpeed
+	}
+	return 0
+}
+
+func (x *FlightData) GetWifiStrength() uint32 {
+	if x != nil {
+		return x.WifiStrength
+	}
+	return 0
+}
+
+func (x *FlightData) GetWifiInterference() uint32 {
+	if x != nil {
+		return x.WifiInterference
+	}
+	return 0
+}
+
+func (x *FlightData) GetLightStrength() uint32 {
+	if x != nil {
+		return x.LightStrength
+	}
+	return 0
+}
+
+func (x *FlightData) GetOverTemp() bool {
+	if x != nil {
+		return x.OverTemp
+	}
+	return false
+}
+
+func (x *FlightData) GetFlyMode() uint32 {
+	if x != nil {
+		return x.FlyMode
+	}
+	return 0
+}
+
+func (x *FlightData) GetMaxHeight() uint32 {
+	if x != nil {
+		return x.MaxHeight
+	}
+	return 0
+}
+
+func (x *FlightData) GetSsid() string {
+	if x != nil {
+		return x.Ssid
+	}
+	return ""
+}
+
+func (x *FlightData) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *FlightData) GetPitch() int32 {
+	if x != nil {
+		return x.Pitch
+	}
+	return 0
+}
+
+func (x *FlightData) GetRoll() int32 {
+	if x != nil {
+		return x.Roll
+	}
+	return 0
+}
+
+func (x *FlightData) GetYaw() int32 {
+	if x != nil {
+		return x.Yaw
+	}
+	return 0
+}
+
+func (x *FlightData) GetPositionX() float32 {
+	if x != nil {
+		return x.PositionX
+	}
+	return 0
+}
+
+func (x *FlightData) GetPositionY() float32 {
+	if x != nil {
+		return x.PositionY
+	}
+	return 0
+}
+
+func (x *FlightData) GetPositionZ() float32 {
+	if x != nil {
+		return x.PositionZ
+	}
+	return 0
+}
+
+// StickInput sets all four sticks, each is in the range -32768..32767 with positive
+// values meaning right, forward, up and clockwise.
+type StickInput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rx            int32                  `protobuf:"varint,1,opt,name=rx,proto3" json:"rx,omitempty"`
+	Ry            int32                  `protobuf:"varint,2,opt,name=ry,proto3" json:"ry,omitempty"`
+	Lx            int32                  `protobuf:"varint,3,opt,name=lx,proto3" json:"lx,omitempty"`
+	Ly            int32                  `protobuf:"varint,4,opt,name=ly,proto3" json:"ly,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StickInput) Reset() {
+	*x = StickInput{}
+	mi := &file_tello_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StickInput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StickInput) ProtoMessage() {}
+
+func (x *StickInput) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StickInput.ProtoReflect.Descriptor instead.
+func (*StickInput) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StickInput) GetRx() int32 {
+	if x != nil {
+		return x.Rx
+	}
+	return 0
+}
+
+func (x *StickInput) GetRy() int32 {
+	if x != nil {
+		return x.Ry
+	}
+	return 0
+}
+
+func (x *StickInput) GetLx() int32 {
+	if x != nil {
+		return x.Lx
+	}
+	return 0
+}
+
+func (x *StickInput) GetLy() int32 {
+	if x != nil {
+		return x.Ly
+	}
+	return 0
+}
+
+// StickSummary is returned when a client closes its stick stream.
+type StickSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Received      int32                  `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StickSummary) Reset() {
+	*x = StickSummary{}
+	mi := &file_tello_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StickSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StickSummary) ProtoMessage() {}
+
+func (x *StickSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StickSummary.ProtoReflect.Descriptor instead.
+func (*StickSummary) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StickSummary) GetReceived() int32 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+// AccessUnit is one complete H.264 frame in Annex-B format, including any preceding
+// SPS and PPS.
+type AccessUnit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccessUnit) Reset() {
+	*x = AccessUnit{}
+	mi := &file_tello_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccessUnit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccessUnit) ProtoMessage() {}
+
+func (x *AccessUnit) ProtoReflect() protoreflect.Message {
+	mi := &file_tello_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccessUnit.ProtoReflect.Descriptor instead.
+func (*AccessUnit) Descriptor() ([]byte, []int) {
+	return file_tello_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AccessUnit) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *AccessUnit) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_tello_proto protoreflect.FileDescriptor
+
+const file_tello_proto_rawDesc = "" +
+	"\n" +
+	"\vtello.proto\x12\ftellodesktop\x1a\x1fgoogle/protobuf/timestamp.proto\"\a\n" +
+	"\x05Empty\"8\n" +
+	"\fCommandReply\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"+\n" +
+	"\vFlipRequest\x12\x1c\n" +
+	"\tdirection\x18\x01 \x01(\tR\tdirection\"&\n" +
+	"\x10VideoModeRequest\x12\x12\n" +
+	"\x04wide\x18\x01 \x01(\bR\x04wide\"0\n" +
+	"\x11FlightDataRequest\x12\x1b\n" +
+	"\tperiod_ms\x18\x01 \x01(\x05R\bperiodMs\"\xd9\a\n" +
+	"\n" +
+	"FlightData\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x16\n" +
+	"\x06flying\x18\x02 \x01(\bR\x06flying\x12\x1b\n" +
+	"\ton_ground\x18\x03 \x01(\bR\bonGround\x12\x1f\n" +
+	"\vdrone_hover\x18\x04 \x01(\bR\n" +
+	"droneHover\x12\x17\n" +
+	"\aem_open\x18\x05 \x01(\bR\x06emOpen\x12\x16\n" +
+	"\x06height\x18\x06 \x01(\x05R\x06height\x12-\n" +
+	"\x12battery_percentage\x18\a \x01(\x05R\x11batteryPercentage\x12\x1f\n" +
+	"\vbattery_low\x18\b \x01(\bR\n" +
+	"batteryLow\x12)\n" +
+	"\x10battery_critical\x18\t \x01(\bR\x0fbatteryCritical\x12.\n" +
+	"\x13battery_milli_volts\x18\n" +
+	" \x01(\x05R\x11batteryMilliVolts\x12\x19\n" +
+	"\bfly_time\x18\v \x01(\x05R\aflyTime\x12-\n" +
+	"\x13drone_fly_time_left\x18\f \x01(\x05R\x10droneFlyTimeLeft\x12\x1f\n" +
+	"\vnorth_speed\x18\r \x01(\x05R\n" +
+	"northSpeed\x12\x1d\n" +
+	"\n" +
+	"east_speed\x18\x0e \x01(\x05R\teastSpeed\x12%\n" +
+	"\x0evertical_speed\x18\x0f \x01(\x05R\rverticalSpeed\x12!\n" +
+	"\fground_speed\x18\x10 \x01(\x05R\vgroundSpeed\x12#\n" +
+	"\rwifi_strength\x18\x11 \x01(\rR\fwifiStrength\x12+\n" +
+	"\x11wifi_interference\x18\x12 \x01(\rR\x10wifiInterference\x12%\n" +
+	"\x0elight_strength\x18\x13 \x01(\rR\rlightStrength\x12\x1b\n" +
+	"\tover_temp\x18\x14 \x01(\bR\boverTemp\x12\x19\n" +
+	"\bfly_mode\x18\x15 \x01(\rR\aflyMode\x12\x1d\n" +
+	"\n" +
+	"max_height\x18\x16 \x01(\rR\tmaxHeight\x12\x12\n" +
+	"\x04ssid\x18\x17 \x01(\tR\x04ssid\x12\x18\n" +
+	"\aversion\x18\x18 \x01(\tR\aversion\x12\x14\n" +
+	"\x05pitch\x18\x19 \x01(\x05R\x05pitch\x12\x12\n" +
+	"\x04roll\x18\x1a \x01(\x05R\x04roll\x12\x10\n" +
+	"\x03yaw\x18\x1b \x01(\x05R\x03yaw\x12\x1d\n" +
+	"\n" +
+	"position_x\x18\x1c \x01(\x02R\tpositionX\x12\x1d\n" +
+	"\n" +
+	"position_y\x18\x1d \x01(\x02R\tpositionY\x12\x1d\n" +
+	"\n" +
+	"position_z\x18\x1e \x01(\x02R\tpositionZ\"L\n" +
+	"\n" +
+	"StickInput\x12\x0e\n" +
+	"\x02rx\x18\x01 \x01(\x05R\x02rx\x12\x0e\n" +
+	"\x02ry\x18\x02 \x01(\x05R\x02ry\x12\x0e\n" +
+	"\x02lx\x18\x03 \x01(\x05R\x02lx\x12\x0e\n" +
+	"\x02ly\x18\x04 \x01(\x05R\x02ly\"*\n" +
+	"\fStickSummary\x12\x1a\n" +
+	"\breceived\x18\x01 \x01(\x05R\breceived\"P\n" +
+	"\n" +
+	"AccessUnit\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data2\xa0\x04\n" +
+	"\x05Tello\x12:\n" +
+	"\aTakeOff\x12\x13.tellodesktop.Empty\x1a\x1a.tellodesktop.CommandReply\x127\n" +
+	"\x04Land\x12\x13.tellodesktop.Empty\x1a\x1a.tellodesktop.CommandReply\x12=\n" +
+	"\x04Flip\x12\x19.tellodesktop.FlipRequest\x1a\x1a.tellodesktop.CommandReply\x12>\n" +
+	"\vTakePicture\x12\x13.tellodesktop.Empty\x1a\x1a.tellodesktop.CommandReply\x12J\n" +
+	"\fSetVideoMode\x12\x1e.tellodesktop.VideoModeRequest\x1a\x1a.tellodesktop.CommandReply\x12O\n" +
+	"\x10StreamFlightData\x12\x1f.tellodesktop.FlightDataRequest\x1a\x18.tellodesktop.FlightData0\x01\x12F\n" +
+	"\fStreamSticks\x12\x18.tellodesktop.StickInput\x1a\x1a.tellodesktop.StickSummary(\x01\x12>\n" +
+	"\vStreamVideo\x12\x13.tellodesktop.Empty\x1a\x18.tellodesktop.AccessUnit0\x01B,Z*github.com/SMerrony/tello-desktop/tellorpcb\x06proto3"
+
+var (
+	file_tello_proto_rawDescOnce sync.Once
+	file_tello_proto_rawDescData []byte
+)
+
+func file_tello_proto_rawDescGZIP() []byte {
+	file_tello_proto_rawDescOnce.Do(func() {
+		file_tello_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tello_proto_rawDesc), len(file_tello_proto_rawDesc)))
+	})
+	return file_tello_proto_rawDescData
+}
+
+var file_tello_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_tello_proto_goTypes = []any{
+	(*Empty)(nil),                 // 0: tellodesktop.Empty
+	(*CommandReply)(nil),          // 1: tellodesktop.CommandReply
+	(*FlipRequest)(nil),           // 2: tellodesktop.FlipRequest
+	(*VideoModeRequest)(nil),      // 3: tellodesktop.VideoModeRequest
+	(*FlightDataRequest)(nil),     // 4: tellodesktop.FlightDataRequest
+	(*FlightData)(nil),            // 5: tellodesktop.FlightData
+	(*StickInput)(nil),            // 6: tellodesktop.StickInput
+	(*StickSummary)(nil),          // 7: tellodesktop.StickSummary
+	(*AccessUnit)(nil),            // 8: tellodesktop.AccessUnit
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+}
+var file_tello_proto_depIdxs = []int32{
+	9,  // 0: tellodesktop.FlightData.time:type_name -> google.protobuf.Timestamp
+	9,  // 1: tellodesktop.AccessUnit.time:type_name -> google.protobuf.Timestamp
+	0,  // 2: tellodesktop.Tello.TakeOff:input_type -> tellodesktop.Empty
+	0,  // 3: tellodesktop.Tello.Land:input_type -> tellodesktop.Empty
+	2,  // 4: tellodesktop.Tello.Flip:input_type -> tellodesktop.FlipRequest
+	0,  // 5: tellodesktop.Tello.TakePicture:input_type -> tellodesktop.Empty
+	3,  // 6: tellodesktop.Tello.SetVideoMode:input_type -> tellodesktop.VideoModeRequest
+	4,  // 7: tellodesktop.Tello.StreamFlightData:input_type -> tellodesktop.FlightDataRequest
+	6,  // 8: tellodesktop.Tello.StreamSticks:input_type -> tellodesktop.StickInput
+	0,  // 9: tellodesktop.Tello.StreamVideo:input_type -> tellodesktop.Empty
+	1,  // 10: tellodesktop.Tello.TakeOff:output_type -> tellodesktop.CommandReply
+	1,  // 11: tellodesktop.Tello.Land:output_type -> tellodesktop.CommandReply
+	1,  // 12: tellodesktop.Tello.Flip:output_type -> tellodesktop.CommandReply
+	1,  // 13: tellodesktop.Tello.TakePicture:output_type -> tellodesktop.CommandReply
+	1,  // 14: tellodesktop.Tello.SetVideoMode:output_type -> tellodesktop.CommandReply
+	5,  // 15: tellodesktop.Tello.StreamFlightData:output_type -> tellodesktop.FlightData
+	7,  // 16: tellodesktop.Tello.StreamSticks:output_type -> tellodesktop.StickSummary
+	8,  // 17: tellodesktop.Tello.StreamVideo:output_type -> tellodesktop.AccessUnit
+	10, // [10:18] is the sub-list for method output_type
+	2,  // [2:10] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_tello_proto_init() }
+func file_tello_proto_init() {
+	if File_tello_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tello_proto_rawDesc), len(file_tello_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tello_proto_goTypes,
+		DependencyIndexes: file_tello_proto_depIdxs,
+		MessageInfos:      file_tello_proto_msgTypes,
+	}.Build()
+	File_tello_proto = out.File
+	file_tello_proto_goTypes = nil
+	file_tello_proto_depIdxs = nil
+}
@@ -0,0 +1,417 @@
+// tello.proto
+
+// Copyright (C) 2018  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// The gRPC API served by tello-desktop when it is started with the -grpc flag.
+// After changing this file regenerate the Go code with "go generate" in this directory.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tello.proto
+
+package tellorpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tello_TakeOff_FullMethodName          = "/tellodesktop.Tello/TakeOff"
+	Tello_Land_FullMethodName             = "/tellodesktop.Tello/Land"
+	Tello_Flip_FullMethodName             = "/tellodesktop.Tello/Flip"
+	Tello_TakePicture_FullMethodName      = "/tellodesktop.Tello/TakePicture"
+	Tello_SetVideoMode_FullMethodName     = "/tellodesktop.Tello/SetVideoMode"
+	Tello_StreamFlightData_FullMethodName = "/tellodesktop.Tello/StreamFlightData"
+	Tello_StreamSticks_FullMethodName     = "/tellodesktop.Tello/StreamSticks"
+	Tello_StreamVideo_FullMethodName      = "/tellodesktop.Tello/StreamVideo"
+)
+
+// TelloClient is the client API for Tello service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TelloClient interface {
+	TakeOff(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*CommandReply, error)
+	Land(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*CommandReply, error)
+	Flip(ctx context.Context, in *FlipRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	// TakePicture takes a still photo which is saved by tello-desktop when it exits.
+	TakePicture(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*CommandReply, error)
+	SetVideoMode(ctx context.Context, in *VideoModeRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	StreamFlightData(ctx context.Context, in *FlightDataRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FlightData], error)
+	// StreamSticks sets the sticks until the stream is closed, which centres them.
+	// In trainer mode the sticks are ignored while the instructor has control.
+	StreamSticks(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StickInput, StickSummary], error)
+	StreamVideo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AccessUnit], error)
+}
+
+type telloClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTelloClient(cc grpc.ClientConnInterface) TelloClient {
+	return &telloClient{cc}
+}
+
+func (c *telloClient) TakeOff(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Tello_TakeOff_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telloClient) Land(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Tello_Land_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telloClient) Flip(ctx context.Context, in *FlipRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Tello_Flip_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telloClient) TakePicture(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Tello_TakePicture_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telloClient) SetVideoMode(ctx context.Context, in *VideoModeRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Tello_SetVideoMode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telloClient) StreamFlightData(ctx context.Context, in *FlightDataRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FlightData], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tello_ServiceDesc.Streams[0], Tello_StreamFlightData_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FlightDataRequest, FlightData]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tello_StreamFlightDataClient = grpc.ServerStreamingClient[FlightData]
+
+func (c *telloClient) StreamSticks(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StickInput, StickSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tello_ServiceDesc.Streams[1], Tello_StreamSticks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StickInput, StickSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tello_StreamSticksClient = grpc.ClientStreamingClient[StickInput, StickSummary]
+
+func (c *telloClient) StreamVideo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AccessUnit], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tello_ServiceDesc.Streams[2], Tello_StreamVideo_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Empty, AccessUnit]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tello_StreamVideoClient = grpc.ServerStreamingClient[AccessUnit]
+
+// TelloServer is the server API for Tello service.
+// All implementations must embed UnimplementedTelloServer
+// for forward compatibility.
+type TelloServer interface {
+	TakeOff(context.Context, *Empty) (*CommandReply, error)
+	Land(context.Context, *Empty) (*CommandReply, error)
+	Flip(context.Context, *FlipRequest) (*CommandReply, error)
+	// TakePicture takes a still photo which is saved by tello-desktop when it exits.
+	TakePicture(context.Context, *Empty) (*CommandReply, error)
+	SetVideoMode(context.Context, *VideoModeRequest) (*CommandReply, error)
+	StreamFlightData(*FlightDataRequest, grpc.ServerStreamingServer[FlightData]) error
+	// StreamSticks sets the sticks until the stream is closed, which centres them.
+	// In trainer mode the sticks are ignored while the instructor has control.
+	StreamSticks(grpc.ClientStreamingServer[StickInput, StickSummary]) error
+	StreamVideo(*Empty, grpc.ServerStreamingServer[AccessUnit]) error
+	mustEmbedUnimplementedTelloServer()
+}
+
+// UnimplementedTelloServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTelloServer struct{}
+
+func (UnimplementedTelloServer) TakeOff(context.Context, *Empty) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TakeOff not implemented")
+}
+func (UnimplementedTelloServer) Land(context.Context, *Empty) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Land not implemented")
+}
+func (UnimplementedTelloServer) Flip(context.Context, *FlipRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Flip not implemented")
+}
+func (UnimplementedTelloServer) TakePicture(context.Context, *Empty) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TakePicture not implemented")
+}
+func (UnimplementedTelloServer) SetVideoMode(context.Context, *VideoModeRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetVideoMode not implemented")
+}
+func (UnimplementedTelloServer) StreamFlightData(*FlightDataRequest, grpc.ServerStreamingServer[FlightData]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamFlightData not implemented")
+}
+func (UnimplementedTelloServer) StreamSticks(grpc.ClientStreamingServer[StickInput, StickSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSticks not implemented")
+}
+func (UnimplementedTelloServer) StreamVideo(*Empty, grpc.ServerStreamingServer[AccessUnit]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamVideo not implemented")
+}
+func (UnimplementedTelloServer) mustEmbedUnimplementedTelloServer() {}
+func (UnimplementedTelloServer) testEmbeddedByValue()               {}
+
+// UnsafeTelloServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TelloServer will
+// result in compilation errors.
+type UnsafeTelloServer interface {
+	mustEmbedUnimplementedTelloServer()
+}
+
+func RegisterTelloServer(s grpc.ServiceRegistrar, srv TelloServer) {
+	// If the following call pancis, it indicates UnimplementedTelloServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tello_ServiceDesc, srv)
+}
+
+func _Tello_TakeOff_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelloServer).TakeOff(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tello_TakeOff_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelloServer).TakeOff(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tello_Land_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelloServer).Land(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tello_Land_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelloServer).Land(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tello_Flip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FlipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelloServer).Flip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tello_Flip_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelloServer).Flip(ctx, req.(*FlipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tello_TakePicture_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelloServer).TakePicture(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tello_TakePicture_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelloServer).TakePicture(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tello_SetVideoMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VideoModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelloServer).SetVideoMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tello_SetVideoMode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelloServer).SetVideoMode(ctx, req.(*VideoModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tello_StreamFlightData_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FlightDataRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TelloServer).StreamFlightData(m, &grpc.GenericServerStream[FlightDataRequest, FlightData]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tello_StreamFlightDataServer = grpc.ServerStreamingServer[FlightData]
+
+func _Tello_StreamSticks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelloServer).StreamSticks(&grpc.GenericServerStream[StickInput, StickSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tello_StreamSticksServer = grpc.ClientStreamingServer[StickInput, StickSummary]
+
+func _Tello_StreamVideo_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TelloServer).StreamVideo(m, &grpc.GenericServerStream[Empty, AccessUnit]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tello_StreamVideoServer = grpc.ServerStreamingServer[AccessUnit]
+
+// Tello_ServiceDesc is the grpc.ServiceDesc for Tello service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tello_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tellodesktop.Tello",
+	HandlerType: (*TelloServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "TakeOff",
+			Handler:    _Tello_TakeOff_Handler,
+		},
+		{
+			MethodName: "Land",
+			Handler:    _Tello_Land_Handler,
+		},
+		{
+			MethodName: "Flip",
+			Handler:    _Tello_Flip_Handler,
+		},
+		{
+			MethodName: "TakePicture",
+			Handler:    _Tello_TakePicture_Handler,
+		},
+		{
+			MethodName: "SetVideoMode",
+			Handler:    _Tello_SetVideoMode_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamFlightData",
+			Handler:       _Tello_StreamFlightData_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamSticks",
+			Handler:       _Tello_StreamSticks_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamVideo",
+			Handler:       _Tello_StreamVideo_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tello.proto",
+}